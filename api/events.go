@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	// timersInterval is the interval the timers are sent to event stream clients,
+	// they are changed by the script without notification.
+	timersInterval = 5 * time.Second
+	// keepAliveInterval keeps idle event streams open through proxies.
+	keepAliveInterval = 30 * time.Second
+)
+
+// eventStream writes server-sent events.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// Send writes value as json encoded event with the given name.
+func (p *eventStream) Send(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrap(err, "marshal event")
+	}
+
+	if _, err := fmt.Fprintf(p.w, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+
+	p.flusher.Flush()
+	return nil
+}
+
+// KeepAlive writes a comment, which is ignored by the client.
+func (p *eventStream) KeepAlive() error {
+	if _, err := fmt.Fprint(p.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+
+	p.flusher.Flush()
+	return nil
+}
+
+// SendTimers sends the current state of all timers.
+func (p *eventStream) SendTimers() error {
+	timers, err := Timers(store.Embedded())
+	if err != nil {
+		return err
+	}
+
+	return p.Send("timers", timers)
+}
+
+// handleEvents streams a snapshot event after each update of the sensor store
+// and a timers event every timersInterval.
+func (p *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	sub := store.Subscribe(32)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, flusher: flusher}
+	if err := stream.Send("snapshot", NewSnapshot(store.Sensor().Snapshot())); err != nil {
+		return
+	}
+	if err := stream.SendTimers(); err != nil {
+		p.logger.Warnf("api: %v", err)
+	}
+
+	timers := time.NewTicker(timersInterval)
+	defer timers.Stop()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			// coalesce the events queued meanwhile into a single snapshot
+			drain(sub)
+			err = stream.Send("snapshot", NewSnapshot(store.Sensor().Snapshot()))
+		case <-timers.C:
+			err = stream.SendTimers()
+		case <-keepAlive.C:
+			err = stream.KeepAlive()
+		}
+
+		if err != nil {
+			p.logger.Debugf("api: event stream closed: %v", err)
+			return
+		}
+	}
+}
+
+// drain discards all pending events of sub.
+func drain(sub store.Subscription) {
+	for {
+		select {
+		case <-sub.C():
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+)
+
+// defaultHistoryLimit bounds the size of a history response.
+const defaultHistoryLimit = 10000
+
+var errLimitReached = errors.New("limit reached")
+
+// Reading is a metric of a snapshot.
+type Reading struct {
+	Metric      string     `json:"metric"`
+	Description string     `json:"description"`
+	Device      string     `json:"device"`
+	Unit        string     `json:"unit"`
+	Value       float64    `json:"value"`
+	Raw         float64    `json:"raw"`
+	Quality     string     `json:"quality"`
+	Updated     *time.Time `json:"updated,omitempty"`
+}
+
+// HistoryRecord holds the values of one poll cycle.
+type HistoryRecord struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+// Snapshot is a consistent view of all metrics.
+type Snapshot struct {
+	Time     time.Time `json:"time"`
+	Readings []Reading `json:"readings"`
+}
+
+// NewSnapshot converts a store.Snapshot.
+func NewSnapshot(snapshot store.Snapshot) Snapshot {
+	result := Snapshot{
+		Time:     snapshot.Time(),
+		Readings: []Reading{},
+	}
+
+	for _, reading := range snapshot.Readings() {
+		item := Reading{
+			Metric:      reading.Metric.ID.String(),
+			Description: reading.Metric.Description,
+			Device:      reading.Metric.Device,
+			Unit:        reading.Metric.Unit,
+			Value:       reading.Value,
+			Raw:         reading.Raw,
+			Quality:     reading.Quality.String(),
+		}
+		if !reading.Updated.IsZero() {
+			updated := reading.Updated
+			item.Updated = &updated
+		}
+
+		result.Readings = append(result.Readings, item)
+	}
+
+	return result
+}
+
+func (p *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openapi)
+}
+
+func (p *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboard)
+}
+
+func (p *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	status := make(map[string]interface{}, len(p.status))
+	for _, entry := range p.status {
+		status[entry.name] = entry.fn()
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (p *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, NewSnapshot(store.Sensor().Snapshot()))
+}
+
+// parseTime parses a time given either as RFC3339 or as a plain date.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time %q, use RFC3339 or YYYY-MM-DD", value)
+	}
+
+	return t, nil
+}
+
+// handleHistory returns the HistoryRecords in [from, to), by default of the last 24 hours.
+func (p *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var err error
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+
+	if value := query.Get("from"); value != "" {
+		if from, err = parseTime(value); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "from"))
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTime(value); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "to"))
+			return
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid limit %q", value))
+			return
+		}
+	}
+
+	var names []string
+	if value := query.Get("metrics"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := store.LookupMetric(name); !ok {
+				writeError(w, http.StatusBadRequest, errors.Errorf("unknown metric %q", name))
+				return
+			}
+			names = append(names, name)
+		}
+	}
+
+	records := []HistoryRecord{}
+	err = store.ForEachHistory(store.Embedded(), from, to, func(rec *store.HistoryRecord) error {
+		if len(records) >= limit {
+			return errLimitReached
+		}
+
+		record := HistoryRecord{Time: rec.Time, Values: rec.Values}
+		if names != nil {
+			record.Values = make(map[string]float64, len(names))
+			for _, name := range names {
+				if value, ok := rec.Values[name]; ok {
+					record.Values[name] = value
+				}
+			}
+		}
+
+		records = append(records, record)
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errLimitReached) {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+//go:embed openapi.yaml
+var openapi []byte
+
+//go:embed dashboard/index.html
+var dashboard []byte
+
+// StatusFunc returns a json encodable status of a service component.
+type StatusFunc func() interface{}
+
+type statusEntry struct {
+	name string
+	fn   StatusFunc
+}
+
+// Server is the http api of the service.
+type Server struct {
+	config *config.Config
+	logger *logrus.Logger
+	mux    *http.ServeMux
+
+	mutex  sync.RWMutex
+	status []statusEntry
+}
+
+// New creates a new Server.
+//
+// Parameters:
+// - logger: the logger to use.
+// - config: the service configuration.
+//
+// Returns:
+// - *Server: the newly created Server.
+func New(logger *logrus.Logger, config *config.Config) *Server {
+	server := &Server{
+		config: config,
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("GET /api/v1/openapi.yaml", server.handleOpenAPI)
+	server.mux.HandleFunc("GET /api/v1/status", server.handleStatus)
+	server.mux.HandleFunc("GET /api/v1/snapshot", server.handleSnapshot)
+	server.mux.HandleFunc("GET /api/v1/history", server.handleHistory)
+	server.mux.HandleFunc("GET /api/v1/timers", server.handleTimers)
+	server.mux.HandleFunc("GET /api/v1/timers/{name}", server.handleTimer)
+	server.mux.HandleFunc("POST /api/v1/timers/{name}/override", server.handleOverride)
+	server.mux.HandleFunc("GET /api/v1/events", server.handleEvents)
+
+	if config.Api.Dashboard {
+		server.mux.HandleFunc("GET /{$}", server.handleDashboard)
+	}
+
+	return server
+}
+
+// AddStatus adds the status of a component to the status endpoint.
+func (p *Server) AddStatus(name string, fn StatusFunc) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status = append(p.status, statusEntry{name: name, fn: fn})
+}
+
+// Handler returns the http handler of the api, which checks the token if one is configured.
+//
+// The dashboard page holds no data, so it is served without token and asks for it.
+func (p *Server) Handler() http.Handler {
+	token := p.config.Api.Token
+	if token == "" {
+		return p.mux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			p.mux.ServeHTTP(w, r)
+			return
+		}
+
+		// EventSource can't set headers, so the token is accepted as query parameter too
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if given == "" {
+			given = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+
+		p.mux.ServeHTTP(w, r)
+	})
+}
+
+// Serve serves the api on the configured address until ctx is done.
+func (p *Server) Serve(ctx context.Context, eg *errgroup.Group) error {
+	server := &http.Server{
+		Addr:              p.config.Api.Listen,
+		Handler:           p.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// cancel open event streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	listener, err := net.Listen("tcp", p.config.Api.Listen)
+	if err != nil {
+		return errors.Wrap(err, "listen for api server")
+	}
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		p.logger.Info("api-server: done received -> closing")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	})
+
+	eg.Go(func() error {
+		p.logger.Infof("api-server: listening on %s", p.config.Api.Listen)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return errors.Wrap(err, "api server")
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	TimerKindSwitch = "switch"
+	TimerKindPulse  = "pulse"
+)
+
+var (
+	errTimerNotFound         = errors.New("timer not found")
+	errActuatorNotRegistered = errors.New("actuator is not registered yet")
+)
+
+// ActuatorState is the state of the Actuator driven by a timer.
+type ActuatorState struct {
+	On     bool    `json:"on"`
+	Mode   string  `json:"mode"`
+	OnTime float64 `json:"on_time_seconds"`
+	Pulses uint64  `json:"pulses"`
+}
+
+// Timer is the state of a SwitchTimer or PulseTimer.
+type Timer struct {
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Kind          string         `json:"kind"`
+	State         string         `json:"state,omitempty"`
+	SpanStart     *time.Time     `json:"span_start,omitempty"`
+	NextSwitch    *time.Time     `json:"next_switch,omitempty"`
+	OnDuration    string         `json:"on_duration,omitempty"`
+	OffDuration   string         `json:"off_duration,omitempty"`
+	PulseDuration string         `json:"pulse_duration,omitempty"`
+	WaitDuration  string         `json:"wait_duration,omitempty"`
+	Inverted      bool           `json:"inverted"`
+	Actuator      *ActuatorState `json:"actuator,omitempty"`
+}
+
+// Override is the body of an override request.
+type Override struct {
+	// Command is ON, OFF, AUTO, PULSE <duration> or SKIP.
+	Command string `json:"command"`
+}
+
+func newTimer(name string, kind string, span types.Span) Timer {
+	timer := Timer{Name: name, Kind: kind}
+	if !span.IsZero() {
+		start, end := span.Start(), span.End()
+		timer.SpanStart = &start
+		timer.NextSwitch = &end
+	}
+
+	if act, ok := types.Actuators().Get(name); ok {
+		timer.Actuator = &ActuatorState{
+			On:     act.IsOn(),
+			Mode:   act.Mode().String(),
+			OnTime: act.OnTime().Seconds(),
+			Pulses: act.Pulses(),
+		}
+	}
+
+	return timer
+}
+
+func newSwitchTimer(st types.SwitchTimer) Timer {
+	timer := newTimer(st.Name, TimerKindSwitch, st.CurrentSpan)
+	timer.Description = st.Description
+	timer.State = st.CurrentState.String()
+	timer.OnDuration = st.OnDuration.String()
+	timer.OffDuration = st.OffDuration.String()
+	timer.Inverted = st.Inverted
+	return timer
+}
+
+func newPulseTimer(pt types.PulseTimer) Timer {
+	timer := newTimer(pt.Name, TimerKindPulse, pt.CurrentSpan)
+	timer.Description = pt.Description
+	timer.PulseDuration = pt.PulseDuration.String()
+	timer.WaitDuration = pt.WaitDuration.String()
+	timer.Inverted = pt.Inverted
+	return timer
+}
+
+// Timers returns all SwitchTimers and PulseTimers of the embedded store ordered by name.
+func Timers(es store.EmbeddedStore) ([]Timer, error) {
+	var switches []types.SwitchTimer
+	if err := es.Find(nil, &switches); err != nil {
+		return nil, errors.Wrap(err, "find switch timers")
+	}
+
+	var pulses []types.PulseTimer
+	if err := es.Find(nil, &pulses); err != nil {
+		return nil, errors.Wrap(err, "find pulse timers")
+	}
+
+	timers := make([]Timer, 0, len(switches)+len(pulses))
+	for _, st := range switches {
+		timers = append(timers, newSwitchTimer(st))
+	}
+	for _, pt := range pulses {
+		timers = append(timers, newPulseTimer(pt))
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		return timers[i].Name < timers[j].Name
+	})
+
+	return timers, nil
+}
+
+// LookupTimer returns the SwitchTimer or PulseTimer with the given name.
+func LookupTimer(es store.EmbeddedStore, name string) (Timer, error) {
+	var st types.SwitchTimer
+	err := es.Get(name, &st)
+	if err == nil {
+		return newSwitchTimer(st), nil
+	}
+	if !store.IsDocumentNotFoundError(err) {
+		return Timer{}, err
+	}
+
+	var pt types.PulseTimer
+	err = es.Get(name, &pt)
+	if err == nil {
+		return newPulseTimer(pt), nil
+	}
+	if !store.IsDocumentNotFoundError(err) {
+		return Timer{}, err
+	}
+
+	return Timer{}, errors.Wrap(errTimerNotFound, name)
+}
+
+// endSpan returns span cut at now, so the timer switches at its next run.
+func endSpan(span types.Span, now time.Time) types.Span {
+	if span.IsZero() || span.Start().After(now) {
+		return types.NewTimespan(now, 0)
+	}
+
+	return types.NewTimespan(span.Start(), now.Sub(span.Start()))
+}
+
+// SkipTimer ends the current span of the timer, so it switches at the next script run.
+//
+// The script may write the timer concurrently, in this case the skip is lost.
+func SkipTimer(es store.EmbeddedStore, name string) error {
+	now := time.Now()
+
+	var st types.SwitchTimer
+	err := es.Get(name, &st)
+	if err == nil {
+		st.CurrentSpan = endSpan(st.CurrentSpan, now)
+		return es.Upsert(st.Name, st)
+	}
+	if !store.IsDocumentNotFoundError(err) {
+		return err
+	}
+
+	var pt types.PulseTimer
+	err = es.Get(name, &pt)
+	if err == nil {
+		pt.CurrentSpan = endSpan(pt.CurrentSpan, now)
+		return es.Upsert(pt.Name, pt)
+	}
+	if !store.IsDocumentNotFoundError(err) {
+		return err
+	}
+
+	return errors.Wrap(errTimerNotFound, name)
+}
+
+// OverrideTimer executes command on the timer with the given name.
+//
+// SKIP ends the current span of the timer, all other commands are executed on
+// its Actuator like mqtt commands.
+func OverrideTimer(es store.EmbeddedStore, name string, command string, maxPulse time.Duration) error {
+	if strings.EqualFold(strings.TrimSpace(command), "SKIP") {
+		return SkipTimer(es, name)
+	}
+
+	if _, err := LookupTimer(es, name); err != nil {
+		return err
+	}
+
+	act, ok := types.Actuators().Get(name)
+	if !ok {
+		return errors.Wrap(errActuatorNotRegistered, name)
+	}
+
+	return act.Execute(command, maxPulse)
+}
+
+func timerErrorStatus(err error) int {
+	if errors.Is(err, errTimerNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, errActuatorNotRegistered) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (p *Server) handleTimers(w http.ResponseWriter, r *http.Request) {
+	timers, err := Timers(store.Embedded())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timers)
+}
+
+func (p *Server) handleTimer(w http.ResponseWriter, r *http.Request) {
+	timer, err := LookupTimer(store.Embedded(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, timerErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timer)
+}
+
+func (p *Server) handleOverride(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var override Override
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "decode body"))
+		return
+	}
+
+	p.logger.Infof("api: override %s -> %s", name, override.Command)
+
+	maxPulse := time.Second * time.Duration(p.config.Api.MaxPulse)
+	if err := OverrideTimer(store.Embedded(), name, override.Command, maxPulse); err != nil {
+		status := timerErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	timer, err := LookupTimer(store.Embedded(), name)
+	if err != nil {
+		writeError(w, timerErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timer)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+)
+
+func TestOverrideTimerRefusesOnForPulseTimer(t *testing.T) {
+	es := store.NewInMemoryEmbeddedStore()
+	if err := es.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+
+	timer := types.PulseTimer{
+		Name:          "DosePump",
+		PulseDuration: time.Second,
+		WaitDuration:  time.Minute,
+	}
+	if err := es.Upsert(timer.Name, timer); err != nil {
+		t.Fatal(err)
+	}
+
+	types.Actuators().Clear()
+	defer types.Actuators().Clear()
+
+	pin := &gpiotest.Pin{N: "P1_35", L: gpio.Low}
+	act := types.Actuators().Register(timer.Name, types.ActuatorKindPulse, false, pin)
+
+	if err := OverrideTimer(es, timer.Name, "ON", time.Minute); err == nil {
+		t.Fatal("ON was accepted for a pulse timer")
+	}
+	if act.IsOn() || pin.L != gpio.Low || act.Mode() != types.ActuatorModeAuto {
+		t.Errorf("refused ON changed the actuator: on %v, pin %s, mode %s", act.IsOn(), pin.L, act.Mode())
+	}
+
+	if err := OverrideTimer(es, timer.Name, "PULSE 10ms", time.Minute); err != nil {
+		t.Errorf("PULSE: %v", err)
+	}
+	if act.Pulses() != 1 || act.IsOn() {
+		t.Errorf("PULSE: got %d pulses, on %v", act.Pulses(), act.IsOn())
+	}
+
+	if err := OverrideTimer(es, timer.Name, "OFF", time.Minute); err != nil {
+		t.Errorf("OFF: %v", err)
+	}
+	if act.Mode() != types.ActuatorModeManual {
+		t.Errorf("OFF: got mode %s, want manual", act.Mode())
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/denkhaus/sensor/api"
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/script"
+	"github.com/denkhaus/sensor/sink"
+	"golang.org/x/sync/errgroup"
+)
+
+// serveApi starts the http api with the status of the service, the sensor link, the sinks and the scripts.
+func serveApi(
+	ctx context.Context,
+	config *config.Config,
+	reader *DataReader,
+	dispatcher *sink.Dispatcher,
+	eg *errgroup.Group,
+) error {
+	started := time.Now()
+	linkStatus := reader.linkStatus(config)
+
+	server := api.New(logger, config)
+	server.AddStatus("service", func() interface{} {
+		return map[string]interface{}{
+			"version":        BuildVersion,
+			"commit":         BuildCommit,
+			"date":           BuildDate,
+			"started":        started,
+			"uptime_seconds": time.Since(started).Seconds(),
+		}
+	})
+	server.AddStatus("sensor", func() interface{} {
+		up, last := linkStatus()
+		status := map[string]interface{}{"link_up": up}
+		if !last.IsZero() {
+			status["last_reading"] = last
+		}
+		return status
+	})
+	server.AddStatus("sinks", func() interface{} {
+		return dispatcher.Status()
+	})
+	server.AddStatus("scripts", func() interface{} {
+		return script.GetStatus()
+	})
+
+	return server.Serve(ctx, eg)
+}
@@ -0,0 +1,556 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TopicCommand is the prefix of topics the service receives commands on.
+	TopicCommand = "cmnd"
+	// TopicStatus is the prefix of topics the service publishes states and command results to.
+	TopicStatus = "stat"
+
+	// Online and Offline are the payloads of the availability topic.
+	Online  = "online"
+	Offline = "offline"
+
+	// publishTimeout bounds the time to wait for the completion of a publish.
+	publishTimeout = 10 * time.Second
+	// connectTimeout is the time to wait for the initial connection before
+	// the service continues with the broker being unreachable.
+	connectTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("mqtt not connected")
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// LinkStatusFunc reports whether the link to the sensor is up and
+// when the last reading was received.
+type LinkStatusFunc func() (up bool, lastReading time.Time)
+
+// Heartbeat is published periodically to tele/<clientid>/STATE.
+type Heartbeat struct {
+	Time        time.Time `json:"time"`
+	Uptime      int64     `json:"uptime"`
+	Version     string    `json:"version"`
+	Commit      string    `json:"commit"`
+	SensorLink  string    `json:"sensor_link"`
+	LastReading string    `json:"last_reading,omitempty"`
+}
+
+// MessageHandler is called for each message received on a subscribed topic.
+// retained reports whether the broker sent a stored retained message.
+type MessageHandler func(topic string, payload []byte, retained bool)
+
+type subscription struct {
+	qos     byte
+	handler MessageHandler
+	// service marks a subscription of the service, which scripts can't replace
+	service bool
+}
+
+// Broker holds the mqtt connection of the service.
+type Broker struct {
+	client    client
+	config    *config.Config
+	logger    *logrus.Logger
+	build     BuildInfo
+	started   time.Time
+	discovery *discovery
+	format    payloadFormat
+
+	mutex         sync.Mutex
+	subscriptions map[string]subscription
+
+	queue *queue
+	wake  chan struct{}
+}
+
+// New creates a new Broker.
+//
+// Parameters:
+// - logger: the logger to use.
+// - config: the service configuration.
+// - build: the build information, which is announced in discovery and heartbeat messages.
+//
+// Returns:
+// - *Broker: the newly created Broker.
+func New(logger *logrus.Logger, config *config.Config, build BuildInfo) *Broker {
+	return &Broker{
+		config:    config,
+		logger:    logger,
+		build:     build,
+		started:   time.Now(),
+		discovery: newDiscovery(),
+
+		subscriptions: make(map[string]subscription),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// OpenQueue enables buffering of messages published with PublishBuffered in the
+// embedded store while the broker is unreachable. Messages left over from a previous
+// run are replayed after the connection is established.
+func (p *Broker) OpenQueue(es store.EmbeddedStore) error {
+	if p.config.Mqtt.Buffer.Size <= 0 {
+		return nil
+	}
+
+	q, err := newQueue(es, p.config.Mqtt.Buffer.Size)
+	if err != nil {
+		return err
+	}
+
+	if n := q.Len(); n > 0 {
+		p.logger.Infof("mqtt-queue: %d buffered messages restored", n)
+	}
+	if dropped := q.Dropped(); dropped > 0 {
+		p.logger.Warnf("mqtt-queue: %d oldest buffered messages dropped, they exceed -mqtt-buffer-size", dropped)
+	}
+
+	p.queue = q
+	return nil
+}
+
+// AvailabilityTopic returns the topic the online and offline messages are published to.
+func (p *Broker) AvailabilityTopic() string {
+	return p.Topic(p.config.Mqtt.TopicPrefix, "LWT")
+}
+
+// Connect connects to the configured mqtt broker.
+//
+// If the broker is unreachable, the connection is retried in the background
+// and Connect returns without error. The broker publishes the retained last will
+// "offline" to the availability topic if the connection is lost. After each
+// (re)connect "online" and the discovery messages are published, all subscriptions
+// are renewed and the buffered messages are replayed.
+func (p *Broker) Connect() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	format, err := newPayloadFormat(p.config)
+	if err != nil {
+		return err
+	}
+	p.format = format
+
+	tlsConfig, err := newTLSConfig(p.config)
+	if err != nil {
+		return errors.Wrap(err, "mqtt tls error")
+	}
+
+	will := message{
+		topic:    p.AvailabilityTopic(),
+		qos:      1,
+		retained: true,
+		payload:  []byte(Offline),
+	}
+
+	handlers := clientHandlers{
+		onConnect: p.onConnect,
+		onConnectionLost: func(err error) {
+			p.logger.Warnf("mqtt: connection lost: %v", err)
+		},
+	}
+
+	switch p.config.Mqtt.Version {
+	case 3:
+		p.client = newClientV3(p.config, tlsConfig, will, handlers)
+	case 5:
+		if p.client, err = newClientV5(p.config, tlsConfig, will, handlers); err != nil {
+			return err
+		}
+	}
+
+	connected, err := p.client.Connect(connectTimeout)
+	if err != nil {
+		return err
+	}
+
+	if !connected {
+		p.logger.Warnf("mqtt: broker %s unreachable, retrying in background", p.config.Mqtt.Endpoint)
+	}
+
+	return nil
+}
+
+// validate checks the mqtt configuration.
+func (p *Broker) validate() error {
+	mqtt := p.config.Mqtt
+	if mqtt.Version != 3 && mqtt.Version != 5 {
+		return errors.Errorf("unsupported mqtt version %d, use 3 or 5", mqtt.Version)
+	}
+
+	endpoint, err := url.Parse(mqtt.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "invalid mqtt endpoint")
+	}
+
+	switch endpoint.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return errors.Errorf("unsupported mqtt endpoint scheme %q", endpoint.Scheme)
+	}
+
+	if mqtt.Discovery.Enabled && mqtt.Payload.Format == PayloadFormatTemplate && !mqtt.Payload.Scalar {
+		return errors.New("discovery of metrics requires -mqtt-payload-scalar with the template payload format")
+	}
+
+	if mqtt.KeepAlive < 0 || mqtt.KeepAlive > math.MaxUint16 {
+		return errors.Errorf("invalid mqtt keep alive %d", mqtt.KeepAlive)
+	}
+
+	for name, qos := range map[string]int{
+		"sensor":    mqtt.Qos.Sensor,
+		"state":     mqtt.Qos.State,
+		"heartbeat": mqtt.Qos.Heartbeat,
+		"discovery": mqtt.Qos.Discovery,
+		"commands":  mqtt.Qos.Commands,
+	} {
+		if qos < 0 || qos > 2 {
+			return errors.Errorf("invalid mqtt qos %d for %s, use 0, 1 or 2", qos, name)
+		}
+	}
+
+	return nil
+}
+
+func (p *Broker) onConnect() {
+	p.logger.Infof("mqtt: connected to %s", p.config.Mqtt.Endpoint)
+
+	if err := p.Publish(p.AvailabilityTopic(), 1, true, Online); err != nil {
+		p.logger.Warnf("mqtt: publish availability: %v", err)
+	}
+
+	// the broker may have lost its retained messages, so announce everything again
+	p.discovery.reset()
+	if err := p.PublishMetricDiscovery(); err != nil {
+		p.logger.Warnf("mqtt: %v", err)
+	}
+
+	p.mutex.Lock()
+	for topic, sub := range p.subscriptions {
+		if err := p.subscribe(topic, sub); err != nil {
+			p.logger.Warnf("mqtt: %v", err)
+		}
+	}
+	p.mutex.Unlock()
+
+	p.wakeQueue()
+}
+
+// Close publishes "offline" to the availability topic and disconnects from the mqtt broker.
+func (p *Broker) Close() {
+	if p.client == nil {
+		return
+	}
+
+	if err := p.Publish(p.AvailabilityTopic(), 1, true, Offline); err != nil {
+		p.logger.Warnf("mqtt: %v", err)
+	}
+
+	p.client.Disconnect()
+}
+
+// Subscribe calls handler for each message received on topic.
+// The subscription is renewed after a reconnect.
+//
+// Topic filters overlapping a subscription of the service, like the command topics, are refused.
+func (p *Broker) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	return p.addSubscription(topic, subscription{qos: qos, handler: handler})
+}
+
+// subscribeService subscribes topic for the service, see Subscribe.
+func (p *Broker) subscribeService(topic string, qos byte, handler MessageHandler) error {
+	return p.addSubscription(topic, subscription{qos: qos, handler: handler, service: true})
+}
+
+func (p *Broker) addSubscription(topic string, sub subscription) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for filter, existing := range p.subscriptions {
+		if existing.service && TopicsOverlap(filter, topic) {
+			return errors.Errorf("topic %s overlaps %s subscribed by the service", topic, filter)
+		}
+	}
+
+	p.subscriptions[topic] = sub
+
+	if !p.client.IsConnectionOpen() {
+		// subscribed by onConnect
+		return nil
+	}
+
+	return p.subscribe(topic, sub)
+}
+
+// Unsubscribe removes the subscription of topic. Subscriptions of the service can't be removed.
+func (p *Broker) Unsubscribe(topic string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.subscriptions[topic].service {
+		return errors.Errorf("topic %s is subscribed by the service", topic)
+	}
+
+	delete(p.subscriptions, topic)
+
+	if !p.client.IsConnectionOpen() {
+		return nil
+	}
+
+	return p.client.Unsubscribe(topic)
+}
+
+func (p *Broker) subscribe(topic string, sub subscription) error {
+	return p.client.Subscribe(topic, sub.qos, sub.handler)
+}
+
+// RunHeartbeat publishes a Heartbeat every interval until ctx is done.
+func (p *Broker) RunHeartbeat(ctx context.Context, interval time.Duration, linkStatus LinkStatusFunc) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		up, lastReading := linkStatus()
+
+		heartbeat := Heartbeat{
+			Time:       time.Now(),
+			Uptime:     int64(time.Since(p.started).Seconds()),
+			Version:    p.build.Version,
+			Commit:     p.build.Commit,
+			SensorLink: "down",
+		}
+		if up {
+			heartbeat.SensorLink = "up"
+		}
+		if !lastReading.IsZero() {
+			heartbeat.LastReading = lastReading.Format(time.RFC3339)
+		}
+
+		topic := p.Topic(p.config.Mqtt.TopicPrefix, "STATE")
+		if err := p.Publish(topic, byte(p.config.Mqtt.Qos.Heartbeat), p.config.Mqtt.Retain.Heartbeat, heartbeat); err != nil {
+			p.logger.Warnf("mqtt-heartbeat: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			p.logger.Info("mqtt-heartbeat: done received -> closing")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Topic returns the topic <prefix>/<clientid>/<name>.
+func (p *Broker) Topic(prefix string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", prefix, p.config.Mqtt.ClientID, name)
+}
+
+// Publish publishes payload to topic and waits for completion.
+//
+// The payload may be a string, a byte slice or any value, which is then encoded as json.
+// The user properties are only sent with mqtt 5.
+func (p *Broker) Publish(topic string, qos byte, retained bool, payload interface{}, props ...UserProperty) error {
+	msg := message{
+		topic:      topic,
+		qos:        qos,
+		retained:   retained,
+		properties: props,
+	}
+
+	switch data := payload.(type) {
+	case string:
+		msg.payload = []byte(data)
+	case []byte:
+		msg.payload = data
+	default:
+		buf, err := json.Marshal(payload)
+		if err != nil {
+			return errors.Wrapf(err, "mqtt payload error for topic %s", topic)
+		}
+		msg.payload = buf
+	}
+
+	// fail fast while reconnecting, the caller decides whether to buffer the message
+	if p.client == nil || !p.client.IsConnectionOpen() {
+		metrics.MqttPublished.WithLabelValues("failure").Inc()
+		return errors.Wrapf(ErrNotConnected, "publish to topic %s", topic)
+	}
+
+	if err := p.client.Publish(msg); err != nil {
+		metrics.MqttPublished.WithLabelValues("failure").Inc()
+		return err
+	}
+
+	metrics.MqttPublished.WithLabelValues("success").Inc()
+
+	p.logger.Debugf("mqtt:sent->%s", topic)
+	return nil
+}
+
+// PublishSnapshot publishes the metrics of a poll cycle in the configured payload format to
+// <prefix>/<clientid>/SENSOR and, if enabled, the value of each metric to <prefix>/<clientid>/<metric>.
+// The messages are buffered while the broker is unreachable.
+func (p *Broker) PublishSnapshot(snapshot store.Snapshot) error {
+	qos := byte(p.config.Mqtt.Qos.Sensor)
+	retained := p.config.Mqtt.Retain.Sensor
+
+	payload, err := p.format.Payload(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "mqtt payload error")
+	}
+
+	topic := p.Topic(p.config.Mqtt.TopicPrefix, "SENSOR")
+	if err := p.PublishBuffered(topic, qos, retained, payload, UnitProperties()...); err != nil {
+		return err
+	}
+
+	if !p.config.Mqtt.Payload.Scalar {
+		return nil
+	}
+
+	// the time of the cycle keeps values replayed from the queue apart from current ones
+	timestamp := UserProperty{Key: "time", Value: snapshot.Time().Format(time.RFC3339)}
+
+	for _, reading := range snapshot.Readings() {
+		if reading.Quality == store.QualityMissing {
+			continue
+		}
+
+		props := []UserProperty{timestamp}
+		if reading.Metric.Unit != "" {
+			props = append(props, UserProperty{Key: "unit", Value: reading.Metric.Unit})
+		}
+
+		topic := p.Topic(p.config.Mqtt.TopicPrefix, reading.Metric.ID.String())
+		if err := p.PublishBuffered(topic, qos, retained, []byte(scalarValue(reading)), props...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PublishBuffered publishes payload to topic. If the broker is unreachable, or older
+// messages are still buffered, the message is appended to the queue and replayed later.
+// Without queue the message is dropped.
+func (p *Broker) PublishBuffered(topic string, qos byte, retained bool, payload []byte, props ...UserProperty) error {
+	if p.queue == nil {
+		return p.Publish(topic, qos, retained, payload, props...)
+	}
+
+	if p.queue.Len() == 0 {
+		err := p.Publish(topic, qos, retained, payload, props...)
+		if err == nil {
+			return nil
+		}
+
+		p.logger.Warnf("mqtt: %v -> buffering", err)
+	}
+
+	msg := QueuedMessage{
+		Topic:      topic,
+		QoS:        qos,
+		Retained:   retained,
+		Payload:    payload,
+		Properties: props,
+		Queued:     time.Now(),
+	}
+
+	if err := p.queue.Push(msg); err != nil {
+		return err
+	}
+
+	p.wakeQueue()
+	return nil
+}
+
+func (p *Broker) wakeQueue() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunQueue replays the buffered messages in order whenever the broker is connected,
+// until ctx is done.
+func (p *Broker) RunQueue(ctx context.Context) error {
+	if p.queue == nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	// drops while opening the queue are reported by OpenQueue
+	reported := p.queue.Dropped()
+	for {
+		if err := p.replayQueue(ctx); err != nil {
+			p.logger.Warnf("mqtt-queue: %v", err)
+		}
+
+		if dropped := p.queue.Dropped(); dropped > reported {
+			p.logger.Warnf("mqtt-queue: buffer full, %d oldest messages dropped", dropped-reported)
+			reported = dropped
+		}
+
+		select {
+		case <-ctx.Done():
+			p.logger.Info("mqtt-queue: done received -> closing")
+			return nil
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// replayQueue publishes buffered messages until the queue is empty or publishing fails.
+func (p *Broker) replayQueue(ctx context.Context) error {
+	replayed := 0
+	defer func() {
+		if replayed > 0 {
+			p.logger.Infof("mqtt-queue: %d buffered messages replayed, %d left", replayed, p.queue.Len())
+		}
+	}()
+
+	for ctx.Err() == nil && p.client.IsConnectionOpen() {
+		msg, ok, err := p.queue.Peek()
+		if err != nil || !ok {
+			return err
+		}
+
+		if err := p.Publish(msg.Topic, msg.QoS, msg.Retained, msg.Payload, msg.Properties...); err != nil {
+			return err
+		}
+
+		if err := p.queue.Pop(msg); err != nil {
+			return err
+		}
+		replayed++
+	}
+
+	return nil
+}
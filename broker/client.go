@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+)
+
+// UserProperty is a mqtt 5 user property sent along with a message.
+// User properties are ignored with mqtt 3.1.1.
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// UnitProperties returns a user property "unit.<metric>" for each registered metric with a unit.
+func UnitProperties() []UserProperty {
+	props := []UserProperty{}
+	for _, metric := range store.Metrics() {
+		if metric.Unit != "" {
+			props = append(props, UserProperty{Key: "unit." + metric.ID.String(), Value: metric.Unit})
+		}
+	}
+
+	return props
+}
+
+// message is a message to be published.
+type message struct {
+	topic      string
+	qos        byte
+	retained   bool
+	payload    []byte
+	properties []UserProperty
+}
+
+// clientHandlers are called by a client on changes of the connection state.
+type clientHandlers struct {
+	onConnect        func()
+	onConnectionLost func(err error)
+}
+
+// client is a mqtt connection, which is reestablished automatically.
+// It is implemented for mqtt 3.1.1 and mqtt 5.
+type client interface {
+	// Connect starts connecting and reports whether the connection was
+	// established within timeout. Otherwise it is retried in the background.
+	Connect(timeout time.Duration) (bool, error)
+	IsConnectionOpen() bool
+	// Publish publishes msg and waits for completion.
+	Publish(msg message) error
+	Subscribe(topic string, qos byte, handler MessageHandler) error
+	Unsubscribe(topic string) error
+	Disconnect()
+}
+
+// MatchTopic reports whether topic matches the topic filter, which may contain the wildcards + and #.
+func MatchTopic(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for idx, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if idx >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[idx] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// TopicsOverlap reports whether a topic exists, which matches both topic filters.
+func TopicsOverlap(a string, b string) bool {
+	levelsA := strings.Split(a, "/")
+	levelsB := strings.Split(b, "/")
+
+	for idx := 0; idx < len(levelsA) && idx < len(levelsB); idx++ {
+		if levelsA[idx] == "#" || levelsB[idx] == "#" {
+			return true
+		}
+		if levelsA[idx] != "+" && levelsB[idx] != "+" && levelsA[idx] != levelsB[idx] {
+			return false
+		}
+	}
+
+	// "a/#" matches "a" too
+	switch {
+	case len(levelsA) == len(levelsB):
+		return true
+	case len(levelsA) == len(levelsB)+1:
+		return levelsA[len(levelsB)] == "#"
+	case len(levelsB) == len(levelsA)+1:
+		return levelsB[len(levelsA)] == "#"
+	}
+
+	return false
+}
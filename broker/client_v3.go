@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+)
+
+// clientV3 is a mqtt 3.1.1 client.
+type clientV3 struct {
+	client paho.Client
+}
+
+func newClientV3(config *config.Config, tlsConfig *tls.Config, will message, handlers clientHandlers) client {
+	opts := paho.NewClientOptions().AddBroker(config.Mqtt.Endpoint)
+	opts.SetClientID(config.Mqtt.ClientID).
+		SetUsername(config.Mqtt.Username).
+		SetPassword(config.Mqtt.Password).
+		SetProtocolVersion(4).
+		SetTLSConfig(tlsConfig).
+		SetKeepAlive(time.Second*time.Duration(config.Mqtt.KeepAlive)).
+		SetCleanSession(config.Mqtt.CleanSession).
+		SetBinaryWill(will.topic, will.payload, will.qos, will.retained).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectionLostHandler(func(client paho.Client, err error) {
+			handlers.onConnectionLost(err)
+		}).
+		SetOnConnectHandler(func(client paho.Client) {
+			handlers.onConnect()
+		})
+
+	return &clientV3{client: paho.NewClient(opts)}
+}
+
+func (p *clientV3) Connect(timeout time.Duration) (bool, error) {
+	token := p.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return false, nil
+	}
+
+	if token.Error() != nil {
+		return false, errors.Wrap(token.Error(), "mqtt connect error")
+	}
+
+	return true, nil
+}
+
+// IsConnectionOpen reports whether the connection is established.
+// While reconnecting, paho would keep published messages in memory, so the
+// Broker has to check the connection before publishing.
+func (p *clientV3) IsConnectionOpen() bool {
+	return p.client.IsConnectionOpen()
+}
+
+func (p *clientV3) Publish(msg message) error {
+	token := p.client.Publish(msg.topic, msg.qos, msg.retained, msg.payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return errors.Errorf("mqtt publish timeout for topic %s", msg.topic)
+	}
+
+	if token.Error() != nil {
+		return errors.Wrapf(token.Error(), "mqtt publish error for topic %s", msg.topic)
+	}
+
+	return nil
+}
+
+func (p *clientV3) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	token := p.client.Subscribe(topic, qos, func(client paho.Client, msg paho.Message) {
+		handler(msg.Topic(), msg.Payload(), msg.Retained())
+	})
+
+	if token.Wait() && token.Error() != nil {
+		return errors.Wrapf(token.Error(), "mqtt subscribe error for topic %s", topic)
+	}
+
+	return nil
+}
+
+func (p *clientV3) Unsubscribe(topic string) error {
+	token := p.client.Unsubscribe(topic)
+	if token.Wait() && token.Error() != nil {
+		return errors.Wrapf(token.Error(), "mqtt unsubscribe error for topic %s", topic)
+	}
+
+	return nil
+}
+
+func (p *clientV3) Disconnect() {
+	p.client.Disconnect(250)
+}
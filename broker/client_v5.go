@@ -0,0 +1,234 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/pkg/errors"
+)
+
+// sessionExpiryInterval is the lifetime of the session in seconds after the
+// connection is lost, if clean sessions are disabled.
+const sessionExpiryInterval = 24 * 60 * 60
+
+// clientV5 is a mqtt 5 client.
+type clientV5 struct {
+	cfg      autopaho.ClientConfig
+	handlers clientHandlers
+	cancel   context.CancelFunc
+
+	// mutex guards manager too, OnConnectionUp may be called before NewConnection returns
+	mutex     sync.RWMutex
+	manager   *autopaho.ConnectionManager
+	connected bool
+	routes    map[string]MessageHandler
+}
+
+func newClientV5(config *config.Config, tlsConfig *tls.Config, will message, handlers clientHandlers) (client, error) {
+	endpoint, err := url.Parse(config.Mqtt.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mqtt endpoint")
+	}
+
+	p := &clientV5{
+		handlers: handlers,
+		routes:   make(map[string]MessageHandler),
+	}
+
+	p.cfg = autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{endpoint},
+		TlsCfg:                        tlsConfig,
+		KeepAlive:                     uint16(config.Mqtt.KeepAlive),
+		CleanStartOnInitialConnection: config.Mqtt.CleanSession,
+		ReconnectBackoff:              autopaho.NewConstantBackoff(10 * time.Second),
+		ConnectTimeout:                connectTimeout,
+		ConnectUsername:               config.Mqtt.Username,
+		ConnectPassword:               []byte(config.Mqtt.Password),
+		OnConnectionUp: func(manager *autopaho.ConnectionManager, _ *paho.Connack) {
+			p.mutex.Lock()
+			p.manager = manager
+			p.connected = true
+			p.mutex.Unlock()
+
+			handlers.onConnect()
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:          config.Mqtt.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){p.route},
+			OnClientError: func(err error) {
+				p.setConnected(false)
+				handlers.onConnectionLost(err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				p.setConnected(false)
+				handlers.onConnectionLost(errors.Errorf("disconnected by server, reason code %d", d.ReasonCode))
+			},
+		},
+	}
+
+	if !config.Mqtt.CleanSession {
+		p.cfg.SessionExpiryInterval = sessionExpiryInterval
+	}
+
+	p.cfg.SetWillMessage(will.topic, will.payload, will.qos, will.retained)
+	return p, nil
+}
+
+func (p *clientV5) setConnected(connected bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.connected = connected
+}
+
+// connection returns the connection manager, which is nil until the first connection attempt.
+func (p *clientV5) connection() (*autopaho.ConnectionManager, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.manager == nil {
+		return nil, ErrNotConnected
+	}
+
+	return p.manager, nil
+}
+
+// route calls the handlers of all subscriptions matching the topic of a received message.
+// The handlers are called without holding the mutex, they may publish.
+func (p *clientV5) route(pr paho.PublishReceived) (bool, error) {
+	var handlers []MessageHandler
+
+	p.mutex.RLock()
+	for filter, handler := range p.routes {
+		if MatchTopic(filter, pr.Packet.Topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	p.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(pr.Packet.Topic, pr.Packet.Payload, pr.Packet.Retain)
+	}
+
+	return len(handlers) > 0, nil
+}
+
+func (p *clientV5) Connect(timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	manager, err := autopaho.NewConnection(ctx, p.cfg)
+	if err != nil {
+		cancel()
+		return false, errors.Wrap(err, "mqtt connect error")
+	}
+
+	p.mutex.Lock()
+	p.manager = manager
+	p.mutex.Unlock()
+	p.cancel = cancel
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, timeout)
+	defer waitCancel()
+
+	return manager.AwaitConnection(waitCtx) == nil, nil
+}
+
+func (p *clientV5) IsConnectionOpen() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.connected
+}
+
+func (p *clientV5) Publish(msg message) error {
+	publish := &paho.Publish{
+		Topic:   msg.topic,
+		QoS:     msg.qos,
+		Retain:  msg.retained,
+		Payload: msg.payload,
+	}
+
+	if len(msg.properties) > 0 {
+		publish.Properties = &paho.PublishProperties{}
+		for _, prop := range msg.properties {
+			publish.Properties.User.Add(prop.Key, prop.Value)
+		}
+	}
+
+	manager, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if _, err := manager.Publish(ctx, publish); err != nil {
+		return errors.Wrapf(err, "mqtt publish error for topic %s", msg.topic)
+	}
+
+	return nil
+}
+
+func (p *clientV5) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	p.mutex.Lock()
+	p.routes[topic] = handler
+	p.mutex.Unlock()
+
+	manager, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	_, err = manager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "mqtt subscribe error for topic %s", topic)
+	}
+
+	return nil
+}
+
+func (p *clientV5) Unsubscribe(topic string) error {
+	p.mutex.Lock()
+	delete(p.routes, topic)
+	p.mutex.Unlock()
+
+	manager, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if _, err := manager.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}}); err != nil {
+		return errors.Wrapf(err, "mqtt unsubscribe error for topic %s", topic)
+	}
+
+	return nil
+}
+
+func (p *clientV5) Disconnect() {
+	manager, err := p.connection()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the manager sends a DISCONNECT packet before it shuts down
+	if err := manager.Disconnect(ctx); err != nil {
+		p.cancel()
+	}
+	p.setConnected(false)
+}
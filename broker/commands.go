@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+// CommandResult is published to stat/<clientid>/<actuator>/RESULT after each command.
+type CommandResult struct {
+	Command string `json:"command"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+	State   string `json:"state,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+}
+
+// HandleCommands subscribes to cmnd/<clientid>/+ and executes the received commands
+// on the actuators, which are listed in the config.
+//
+// Supported commands are ON, OFF, PULSE <duration> and AUTO. ON and OFF suspend
+// the timer of the actuator until AUTO is received.
+func (p *Broker) HandleCommands(actuators *types.ActuatorRegistry) error {
+	if len(p.config.Mqtt.Commands.Actuators) == 0 {
+		p.logger.Info("mqtt-commands: no actuators allowed -> commands disabled")
+		return nil
+	}
+
+	return p.subscribeService(p.Topic(TopicCommand, "+"), byte(p.config.Mqtt.Qos.Commands), func(topic string, payload []byte, retained bool) {
+		name := topic[strings.LastIndex(topic, "/")+1:]
+		command := strings.TrimSpace(string(payload))
+
+		// a pulse blocks, so don't block the mqtt client meanwhile
+		go p.handleCommand(actuators, name, command)
+	})
+}
+
+// isRemoteControllable reports whether the actuator is allowed by the config.
+func (p *Broker) isRemoteControllable(name string) bool {
+	for _, allowed := range p.config.Mqtt.Commands.Actuators {
+		if allowed == "*" || allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Broker) handleCommand(actuators *types.ActuatorRegistry, name string, command string) {
+	p.logger.Infof("mqtt-commands: %s -> %s", name, command)
+
+	result := CommandResult{
+		Command: command,
+		Result:  "ok",
+	}
+
+	act, err := p.executeCommand(actuators, name, command)
+	if err != nil {
+		p.logger.Warnf("mqtt-commands: %s: %v", name, err)
+		result.Result = "error"
+		result.Error = err.Error()
+	}
+
+	if act != nil {
+		result.State = actuatorState(act)
+		result.Mode = act.Mode().String()
+
+		if err := p.publishActuatorState(act); err != nil {
+			p.logger.Warnf("mqtt-commands: %v", err)
+		}
+	}
+
+	if err := p.Publish(p.Topic(TopicStatus, name+"/RESULT"), byte(p.config.Mqtt.Qos.State), false, result); err != nil {
+		p.logger.Warnf("mqtt-commands: %v", err)
+	}
+}
+
+func (p *Broker) executeCommand(actuators *types.ActuatorRegistry, name string, command string) (*types.Actuator, error) {
+	if !p.isRemoteControllable(name) {
+		return nil, errors.Errorf("actuator %s is not remote controllable", name)
+	}
+
+	act, ok := actuators.Get(name)
+	if !ok {
+		return nil, errors.Errorf("unknown actuator %s", name)
+	}
+
+	maxPulse := time.Second * time.Duration(p.config.Mqtt.Commands.MaxPulse)
+	return act, act.Execute(command, maxPulse)
+}
+
+// actuatorState returns ON or OFF.
+func actuatorState(act *types.Actuator) string {
+	if act.IsOn() {
+		return stateOn
+	}
+
+	return stateOff
+}
+
+// publishActuatorState publishes the retained state of a switch actuator.
+func (p *Broker) publishActuatorState(act *types.Actuator) error {
+	if act.Kind() != types.ActuatorKindSwitch {
+		return nil
+	}
+
+	p.discovery.mutex.Lock()
+	defer p.discovery.mutex.Unlock()
+
+	return p.publishState(act.Name, actuatorState(act))
+}
+
+// publishState publishes the retained state of a switch if it changed.
+// The caller must hold the discovery mutex.
+func (p *Broker) publishState(name string, state string) error {
+	if p.discovery.states[name] == state {
+		return nil
+	}
+
+	if err := p.Publish(p.Topic(TopicStatus, fmt.Sprintf("%s/POWER", name)), byte(p.config.Mqtt.Qos.State), true, state); err != nil {
+		return errors.Wrapf(err, "publish state of %s", name)
+	}
+
+	p.discovery.states[name] = state
+	return nil
+}
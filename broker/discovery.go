@@ -0,0 +1,211 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// stateOn and stateOff are the payloads of actuator states and switch commands.
+	stateOn  = "ON"
+	stateOff = "OFF"
+)
+
+// discovery remembers which actuators were announced and their last published state.
+type discovery struct {
+	mutex     sync.Mutex
+	announced map[string]bool
+	states    map[string]string
+}
+
+func newDiscovery() *discovery {
+	return &discovery{
+		announced: make(map[string]bool),
+		states:    make(map[string]string),
+	}
+}
+
+// reset forgets all announced actuators and published states.
+func (p *discovery) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.announced = make(map[string]bool)
+	p.states = make(map[string]string)
+}
+
+// discoveryTopic returns the home assistant discovery topic for the given component and object.
+func (p *Broker) discoveryTopic(component string, objectID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config",
+		p.config.Mqtt.Discovery.Prefix, component, p.config.Mqtt.ClientID, objectID,
+	)
+}
+
+// discoveryDevice returns the device all entities of this service belong to.
+func (p *Broker) discoveryDevice() map[string]interface{} {
+	return map[string]interface{}{
+		"identifiers":  []string{"sensor_" + p.config.Mqtt.ClientID},
+		"name":         p.config.Mqtt.ClientID,
+		"model":        "CWT-Soil-THC-S",
+		"manufacturer": "denkhaus/sensor",
+		"sw_version":   p.build.Version,
+	}
+}
+
+// discoveryConfig returns the config fields shared by all entities.
+func (p *Broker) discoveryConfig(objectID string, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                  name,
+		"unique_id":             fmt.Sprintf("%s_%s", p.config.Mqtt.ClientID, objectID),
+		"availability_topic":    p.AvailabilityTopic(),
+		"payload_available":     Online,
+		"payload_not_available": Offline,
+		"device":                p.discoveryDevice(),
+	}
+}
+
+// PublishMetricDiscovery publishes a retained home assistant sensor config for each registered metric.
+// It does nothing if discovery is disabled.
+//
+// The sensors read the metric topics if they are enabled, otherwise the SENSOR topic.
+// A user defined payload template can't be parsed by home assistant, so metric
+// topics are required for discovery in this case.
+func (p *Broker) PublishMetricDiscovery() error {
+	if !p.config.Mqtt.Discovery.Enabled {
+		return nil
+	}
+
+	for _, metric := range store.Metrics() {
+		config := p.discoveryConfig(metric.ID.String(), metric.Description)
+		if p.config.Mqtt.Payload.Scalar {
+			config["state_topic"] = p.Topic(p.config.Mqtt.TopicPrefix, metric.ID.String())
+		} else {
+			tmpl, ok := p.format.ValueTemplate(metric)
+			if !ok {
+				return errors.Errorf("discovery of metrics requires -mqtt-payload-scalar with payload format %s",
+					p.config.Mqtt.Payload.Format,
+				)
+			}
+
+			config["state_topic"] = p.Topic(p.config.Mqtt.TopicPrefix, "SENSOR")
+			config["value_template"] = tmpl
+		}
+		config["unit_of_measurement"] = metric.Unit
+		config["state_class"] = "measurement"
+		if metric.DeviceClass != "" {
+			config["device_class"] = metric.DeviceClass
+		}
+
+		if err := p.Publish(p.discoveryTopic("sensor", metric.ID.String()), byte(p.config.Mqtt.Qos.Discovery), true, config); err != nil {
+			return errors.Wrapf(err, "publish discovery for metric %s", metric.ID)
+		}
+	}
+
+	return nil
+}
+
+// PublishActuators announces new SwitchTimers as home assistant switches and new
+// PulseTimers as buttons, or both as binary_sensor if mqtt commands aren't allowed for them,
+// and publishes the retained state of each SwitchTimer if it changed.
+// The state of a registered Actuator takes precedence over the stored timer state.
+//
+// Commands are received on cmnd/<clientid>/<actuator>, states are published to
+// stat/<clientid>/<actuator>/POWER.
+//
+// While the broker is unreachable nothing is published, onConnect resets the discovery,
+// so the next call after a reconnect announces and publishes everything again.
+func (p *Broker) PublishActuators(es store.EmbeddedStore) error {
+	if p.client == nil || !p.client.IsConnectionOpen() {
+		return nil
+	}
+
+	var switches []types.SwitchTimer
+	if err := es.Find(nil, &switches); err != nil {
+		return errors.Wrap(err, "find switch timers")
+	}
+
+	var pulses []types.PulseTimer
+	if err := es.Find(nil, &pulses); err != nil {
+		return errors.Wrap(err, "find pulse timers")
+	}
+
+	p.discovery.mutex.Lock()
+	defer p.discovery.mutex.Unlock()
+
+	for _, timer := range switches {
+		if err := p.announceActuator("switch", timer.Name, map[string]interface{}{
+			"state_topic": p.Topic(TopicStatus, timer.Name+"/POWER"),
+			"payload_on":  stateOn,
+			"payload_off": stateOff,
+		}); err != nil {
+			return err
+		}
+
+		state := stateOff
+		if act, ok := types.Actuators().Get(timer.Name); ok {
+			// the actuator may be switched manually
+			state = actuatorState(act)
+		} else if timer.CurrentState == types.SwitchTimerStateOn {
+			state = stateOn
+		}
+
+		if err := p.publishState(timer.Name, state); err != nil {
+			return err
+		}
+	}
+
+	for _, timer := range pulses {
+		if err := p.announceActuator("button", timer.Name, map[string]interface{}{
+			"payload_press": fmt.Sprintf("PULSE %s", timer.PulseDuration),
+		}); err != nil {
+			return err
+		}
+
+		// a read-only pulse timer is a binary_sensor, which needs a state
+		if !p.isRemoteControllable(timer.Name) {
+			state := stateOff
+			if act, ok := types.Actuators().Get(timer.Name); ok {
+				state = actuatorState(act)
+			}
+
+			if err := p.publishState(timer.Name, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// announceActuator publishes the discovery config of an actuator once.
+// Actuators which can't be commanded by mqtt are announced as read-only binary_sensor.
+// The caller must hold the discovery mutex.
+func (p *Broker) announceActuator(component string, name string, fields map[string]interface{}) error {
+	if !p.config.Mqtt.Discovery.Enabled || p.discovery.announced[name] {
+		return nil
+	}
+
+	config := p.discoveryConfig(name, name)
+	if p.isRemoteControllable(name) {
+		config["command_topic"] = p.Topic(TopicCommand, name)
+		for key, value := range fields {
+			config[key] = value
+		}
+	} else {
+		component = "binary_sensor"
+		config["state_topic"] = p.Topic(TopicStatus, name+"/POWER")
+		config["payload_on"] = stateOn
+		config["payload_off"] = stateOff
+	}
+
+	if err := p.Publish(p.discoveryTopic(component, name), byte(p.config.Mqtt.Qos.Discovery), true, config); err != nil {
+		return errors.Wrapf(err, "publish discovery for %s %s", component, name)
+	}
+
+	p.discovery.announced[name] = true
+	return nil
+}
@@ -0,0 +1,180 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PayloadFormatJSON is {"time": ..., "data": {<metric>: value}, "quality": {<metric>: quality}}.
+	PayloadFormatJSON = "json"
+	// PayloadFormatTasmota is {"Time": ..., "<Device>": {"<Metric>": value}} like the SENSOR messages of tasmota.
+	PayloadFormatTasmota = "tasmota"
+	// PayloadFormatTemplate renders a user defined text/template with PayloadData.
+	PayloadFormatTemplate = "template"
+
+	// tasmotaTimeFormat is the local time format used by tasmota.
+	tasmotaTimeFormat = "2006-01-02T15:04:05"
+)
+
+// PayloadData is passed to user defined payload templates.
+type PayloadData struct {
+	Time     time.Time
+	ClientID string
+	Values   map[string]float64
+	Readings []store.Reading
+}
+
+// payloadFormat encodes a Snapshot as the payload of the SENSOR topic.
+type payloadFormat interface {
+	Payload(snapshot store.Snapshot) ([]byte, error)
+	// ValueTemplate returns the home assistant value template extracting metric from the payload,
+	// or false if the payload can't be parsed by home assistant.
+	ValueTemplate(metric store.Metric) (string, bool)
+}
+
+// newPayloadFormat creates the payload format selected by the configuration.
+func newPayloadFormat(config *config.Config) (payloadFormat, error) {
+	switch config.Mqtt.Payload.Format {
+	case PayloadFormatJSON:
+		return jsonFormat{}, nil
+	case PayloadFormatTasmota:
+		return tasmotaFormat{}, nil
+	case PayloadFormatTemplate:
+		return newTemplateFormat(config.Mqtt.Payload.Template, config.Mqtt.ClientID)
+	}
+
+	return nil, errors.Errorf("unknown mqtt payload format %q, use %s, %s or %s",
+		config.Mqtt.Payload.Format, PayloadFormatJSON, PayloadFormatTasmota, PayloadFormatTemplate,
+	)
+}
+
+type jsonFormat struct{}
+
+func (p jsonFormat) Payload(snapshot store.Snapshot) ([]byte, error) {
+	quality := make(map[string]string)
+	for _, reading := range snapshot.Readings() {
+		quality[reading.Metric.ID.String()] = reading.Quality.String()
+	}
+
+	data := map[string]interface{}{
+		"time":    snapshot.Time().Format(time.RFC3339),
+		"data":    snapshot.Values(),
+		"quality": quality,
+	}
+
+	return json.Marshal(data)
+}
+
+func (p jsonFormat) ValueTemplate(metric store.Metric) (string, bool) {
+	return fmt.Sprintf("{{ value_json.data.%s }}", metric.ID), true
+}
+
+type tasmotaFormat struct{}
+
+// tasmotaName converts snake case ids like conductivity_weighted to ConductivityWeighted.
+func tasmotaName(id string) string {
+	parts := strings.Split(id, "_")
+	for idx, part := range parts {
+		if part != "" {
+			parts[idx] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+func (p tasmotaFormat) Payload(snapshot store.Snapshot) ([]byte, error) {
+	data := map[string]interface{}{
+		"Time":     snapshot.Time().Local().Format(tasmotaTimeFormat),
+		"TempUnit": "C",
+	}
+
+	for _, reading := range snapshot.Readings() {
+		if reading.Quality == store.QualityMissing {
+			continue
+		}
+
+		device := tasmotaName(reading.Metric.Device)
+		values, ok := data[device].(map[string]float64)
+		if !ok {
+			values = make(map[string]float64)
+			data[device] = values
+		}
+
+		values[tasmotaName(reading.Metric.ID.String())] = reading.Value
+	}
+
+	return json.Marshal(data)
+}
+
+func (p tasmotaFormat) ValueTemplate(metric store.Metric) (string, bool) {
+	return fmt.Sprintf("{{ value_json.%s.%s }}", tasmotaName(metric.Device), tasmotaName(metric.ID.String())), true
+}
+
+type templateFormat struct {
+	tmpl     *template.Template
+	clientID string
+}
+
+// newTemplateFormat parses the payload template in path.
+//
+// Besides the builtin functions, the template can use "json" to encode a value as json.
+func newTemplateFormat(path string, clientID string) (payloadFormat, error) {
+	if path == "" {
+		return nil, errors.New("mqtt payload template is required for the template format")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read mqtt payload template")
+	}
+
+	funcs := template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			buf, err := json.Marshal(value)
+			return string(buf), err
+		},
+	}
+
+	tmpl, err := template.New(path).Funcs(funcs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse mqtt payload template")
+	}
+
+	return &templateFormat{tmpl: tmpl, clientID: clientID}, nil
+}
+
+func (p *templateFormat) Payload(snapshot store.Snapshot) ([]byte, error) {
+	data := PayloadData{
+		Time:     snapshot.Time(),
+		ClientID: p.clientID,
+		Values:   snapshot.Values(),
+		Readings: snapshot.Readings(),
+	}
+
+	var buf strings.Builder
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "render mqtt payload template")
+	}
+
+	return []byte(buf.String()), nil
+}
+
+func (p *templateFormat) ValueTemplate(metric store.Metric) (string, bool) {
+	return "", false
+}
+
+// scalarValue formats the value of a reading as payload of a metric topic.
+func scalarValue(reading store.Reading) string {
+	return strconv.FormatFloat(reading.Value, 'f', -1, 64)
+}
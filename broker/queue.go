@@ -0,0 +1,157 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+)
+
+const queueKeyPrefix = "mqttqueue/"
+
+// QueuedMessage is a message buffered in the embedded store while the mqtt broker is unreachable.
+type QueuedMessage struct {
+	Key        string `badgerhold:"key"`
+	Topic      string
+	QoS        byte
+	Retained   bool
+	Payload    []byte
+	Properties []UserProperty
+	Queued     time.Time
+}
+
+// queue is a persistent fifo of QueuedMessages.
+//
+// Messages are stored under zero padded sequence numbers in [first, next).
+// If the queue exceeds its limit, the oldest messages are dropped.
+type queue struct {
+	mutex   sync.Mutex
+	es      store.EmbeddedStore
+	limit   uint64
+	first   uint64
+	next    uint64
+	dropped uint64
+}
+
+func queueKey(seq uint64) string {
+	return fmt.Sprintf("%s%020d", queueKeyPrefix, seq)
+}
+
+// newQueue opens the queue and restores the messages left over from a previous run.
+func newQueue(es store.EmbeddedStore, limit int) (*queue, error) {
+	q := &queue{
+		es:    es,
+		limit: uint64(limit),
+	}
+
+	found := false
+	err := es.ForEach(nil, func(msg *QueuedMessage) error {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(msg.Key, queueKeyPrefix), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid queue key %s", msg.Key)
+		}
+
+		if !found || seq < q.first {
+			q.first = seq
+		}
+		if !found || seq >= q.next {
+			q.next = seq + 1
+		}
+
+		found = true
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "restore mqtt queue")
+	}
+
+	// the limit may have been lowered since the previous run
+	if err := q.trim(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Len returns the number of queued messages.
+func (q *queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return int(q.next - q.first)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (q *queue) Dropped() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.dropped
+}
+
+// Push appends msg to the queue and drops the oldest messages if the limit is exceeded.
+func (q *queue) Push(msg QueuedMessage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	msg.Key = queueKey(q.next)
+	if err := q.es.Insert(msg.Key, msg); err != nil {
+		return errors.Wrap(err, "queue mqtt message")
+	}
+	q.next++
+
+	return q.trim()
+}
+
+// trim drops the oldest messages until the queue doesn't exceed its limit.
+// The caller must hold the mutex, unless the queue isn't shared yet.
+func (q *queue) trim() error {
+	for q.next-q.first > q.limit {
+		if err := q.es.Delete(queueKey(q.first), QueuedMessage{}); err != nil && !store.IsDocumentNotFoundError(err) {
+			return errors.Wrap(err, "drop oldest mqtt message")
+		}
+		q.first++
+		q.dropped++
+		metrics.Dropped.WithLabelValues("mqtt_buffer").Inc()
+	}
+
+	return nil
+}
+
+// Peek returns the oldest message without removing it.
+func (q *queue) Peek() (*QueuedMessage, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.first == q.next {
+		return nil, false, nil
+	}
+
+	var msg QueuedMessage
+	if err := q.es.Get(queueKey(q.first), &msg); err != nil {
+		return nil, false, errors.Wrap(err, "peek mqtt message")
+	}
+
+	return &msg, true, nil
+}
+
+// Pop removes the message returned by Peek, unless it has been dropped meanwhile.
+func (q *queue) Pop(msg *QueuedMessage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.first == q.next || queueKey(q.first) != msg.Key {
+		return nil
+	}
+
+	if err := q.es.Delete(msg.Key, QueuedMessage{}); err != nil && !store.IsDocumentNotFoundError(err) {
+		return errors.Wrap(err, "remove mqtt message")
+	}
+
+	q.first++
+	return nil
+}
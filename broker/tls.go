@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/pkg/errors"
+)
+
+// newTLSConfig creates the tls configuration for ssl:// and wss:// endpoints.
+//
+// Parameters:
+// - config: the service configuration holding the CA bundle and client certificate.
+//
+// Returns:
+// - *tls.Config: the tls configuration, which uses the system roots if no CA bundle is configured.
+// - error: an error if a certificate can't be loaded.
+func newTLSConfig(config *config.Config) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.Mqtt.TLS.InsecureSkipVerify,
+	}
+
+	if config.Mqtt.TLS.CA != "" {
+		pem, err := os.ReadFile(config.Mqtt.TLS.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "read CA bundle")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA bundle %s", config.Mqtt.TLS.CA)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if config.Mqtt.TLS.Cert != "" || config.Mqtt.TLS.Key != "" {
+		cert, err := tls.LoadX509KeyPair(config.Mqtt.TLS.Cert, config.Mqtt.TLS.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,125 @@
+// Package clock provides the time to the timers, actuators and the sensor store,
+// so the script test harness can run a script against a simulated clock.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for durations to pass.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+var (
+	mutex   sync.RWMutex
+	current = Real
+)
+
+// Set replaces the global clock and returns the previous one.
+func Set(c Clock) Clock {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	previous := current
+	current = c
+	return previous
+}
+
+// get returns the global clock.
+func get() Clock {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+// Now returns the current time of the global clock.
+func Now() time.Time {
+	return get().Now()
+}
+
+// Since returns the time elapsed since t on the global clock.
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Until returns the duration until t on the global clock.
+func Until(t time.Time) time.Duration {
+	return t.Sub(Now())
+}
+
+// After waits for d to pass on the global clock and then sends the current time on the returned channel.
+func After(d time.Duration) <-chan time.Time {
+	return get().After(d)
+}
+
+// Sleep pauses the current goroutine for d on the global clock.
+func Sleep(d time.Duration) {
+	<-After(d)
+}
+
+// Fake is a simulated clock. It only moves when it is advanced,
+// waiting for a duration advances it immediately.
+type Fake struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFake creates a Fake clock set to start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the simulated time.
+func (p *Fake) Now() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.now
+}
+
+// After advances the clock by d and returns a channel holding the new time,
+// so a pulse or sleep completes without waiting.
+func (p *Fake) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- p.Advance(d)
+	return ch
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (p *Fake) Advance(d time.Duration) time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if d > 0 {
+		p.now = p.now.Add(d)
+	}
+
+	return p.now
+}
+
+// AdvanceTo moves the clock forward to t. The clock never moves backwards.
+func (p *Fake) AdvanceTo(t time.Time) time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if t.After(p.now) {
+		p.now = t
+	}
+
+	return p.now
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Command is a subcommand of the sensor binary, e.g. "sensor export".
+// It receives the arguments following the command name.
+type Command func(args []string) error
+
+var commands = map[string]Command{
+	"export": exportCommand,
+	"repl":   replCommand,
+	"script": scriptCommand,
+}
+
+// runCommand runs the subcommand with the given name.
+//
+// Subcommands write their results to stdout, so logging is redirected to stderr.
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return errors.Errorf("unknown command %q", name)
+	}
+
+	logger.SetOutput(os.Stderr)
+	return cmd(args)
+}
@@ -16,18 +16,100 @@ type Config struct {
 	LogLevel       string `default:"info" usage:"log level"`
 	UpdateInterval int    `default:"5" usage:"updateinterval for sensor data in seconds"`
 	Script         struct {
-		Path        string `default:"./sensor_script.go" usage:"path of the script to run"`
-		RunInterval int    `default:"1" usage:"script run interval in seconds"`
+		Path        []string `default:"./sensor_script.go" usage:"comma separated scripts or directories of scripts to run"`
+		Disabled    []string `usage:"comma separated names of scripts not to run"`
+		Lib         string   `usage:"directory of helper packages importable by the scripts by their path relative to it (default: $GOPATH/src if set)"`
+		RunInterval int      `default:"1" usage:"default script run interval in seconds"`
+		Reload      bool     `default:"true" usage:"reload a script when its file changes"`
+		ErrorPolicy string   `default:"continue" usage:"reaction on script errors: continue, backoff, fail or safe-mode"`
+		MaxErrors   int      `default:"5" usage:"consecutive script errors until the service fails or enters safe mode"`
+		MaxBackoff  int      `default:"60" usage:"maximum delay between script runs after errors in seconds"`
+		Timeout     int      `default:"30" usage:"deadline of a script run in seconds, 0 to disable it"`
+		Watchdog    int      `default:"120" usage:"switch the actuators of a script off if a run takes longer than this in seconds, 0 to disable it"`
+	}
+	Repl struct {
+		Socket    string `usage:"unix socket of the script repl, empty to disable it"`
+		Actuators bool   `default:"false" usage:"allow repl sessions opened with -actuators to switch actuators, publish mqtt messages and write to the stores"`
 	}
 	Storage struct {
-		Id string `default:"default_store" usage:"the storageid of the embedded datastore"`
+		Id               string `default:"default_store" usage:"the storageid of the embedded datastore"`
+		HistoryRetention int    `default:"30" usage:"days to keep sensor history, 0 to keep it forever"`
+	}
+	Api struct {
+		Enabled   bool   `default:"false" usage:"enable the http api"`
+		Listen    string `default:"127.0.0.1:8080" usage:"address of the http api"`
+		Token     string `usage:"bearer token required by the http api, empty to disable authentication"`
+		MaxPulse  int    `default:"10" usage:"maximum duration of a pulse requested by the http api in seconds"`
+		Dashboard bool   `default:"true" usage:"serve the web dashboard on /"`
+	}
+	Metrics struct {
+		Listen string `usage:"address of the prometheus /metrics endpoint, e.g. :9101, empty to disable it"`
+	}
+	Sinks struct {
+		Enabled []string `default:"mqtt" usage:"comma separated list of output sinks: mqtt, influx"`
+		Buffer  int      `default:"100" usage:"number of snapshots buffered per sink"`
+	}
+	Influx struct {
+		URL             string `default:"http://localhost:8086" usage:"influxdb url, http(s):// for the write api or udp://host:port"`
+		API             int    `default:"2" usage:"version of the http write api, 1 or 2"`
+		Database        string `default:"sensor" usage:"database of the v1 write api"`
+		RetentionPolicy string `usage:"retention policy of the v1 write api"`
+		Username        string `usage:"username of the v1 write api"`
+		Password        string `usage:"password of the v1 write api"`
+		Org             string `usage:"organization of the v2 write api"`
+		Bucket          string `default:"sensor" usage:"bucket of the v2 write api"`
+		Token           string `usage:"token of the v2 write api"`
+		Measurement     string `default:"sensor" usage:"measurement of the written points"`
+		Site            string `usage:"value of the site tag"`
+		BatchSize       int    `default:"100" usage:"number of points written in one request"`
+		FlushInterval   int    `default:"10" usage:"interval in seconds to write incomplete batches, 0 to disable"`
+		Gzip            bool   `default:"true" usage:"gzip the request body"`
+		Retries         int    `default:"3" usage:"number of retries of a failed write"`
+		Timeout         int    `default:"10" usage:"timeout of a write request in seconds"`
 	}
 	Mqtt struct {
-		TopicPrefix string `default:"tele" usage:"mqtt topic prefix"`
-		Endpoint    string `default:"tcp://localhost:1883" usage:"mqtt endpoint to send sensor data to"`
-		Username    string `default:"user" usage:"mqtt username"`
-		Password    string `default:"" usage:"mqtt password"`
-		ClientID    string `default:"sensor" usage:"mqtt client id"`
+		TopicPrefix  string `default:"tele" usage:"mqtt topic prefix"`
+		Endpoint     string `default:"tcp://localhost:1883" usage:"mqtt endpoint to send sensor data to, tcp://, ssl:// or ws://, wss:// for websockets"`
+		Username     string `default:"user" usage:"mqtt username"`
+		Password     string `default:"" usage:"mqtt password"`
+		ClientID     string `default:"sensor" usage:"mqtt client id"`
+		Heartbeat    int    `default:"60" usage:"interval of the heartbeat message in seconds, 0 to disable it"`
+		Version      int    `default:"3" usage:"mqtt protocol version, 3 for mqtt 3.1.1 or 5"`
+		KeepAlive    int    `default:"30" usage:"mqtt keep alive in seconds"`
+		CleanSession bool   `default:"true" usage:"start with a clean mqtt session, otherwise subscriptions and inflight messages survive reconnects"`
+		TLS          struct {
+			CA                 string `usage:"path of the CA bundle to verify the broker certificate, default are the system roots"`
+			Cert               string `usage:"path of the client certificate"`
+			Key                string `usage:"path of the client certificate key"`
+			InsecureSkipVerify bool   `default:"false" usage:"don't verify the broker certificate, for lab setups only"`
+		}
+		Qos struct {
+			Sensor    int `default:"0" usage:"qos of sensor data"`
+			State     int `default:"1" usage:"qos of actuator states and command results"`
+			Heartbeat int `default:"0" usage:"qos of heartbeat messages"`
+			Discovery int `default:"0" usage:"qos of home assistant discovery messages"`
+			Commands  int `default:"1" usage:"qos of the command subscription"`
+		}
+		Retain struct {
+			Sensor    bool `default:"true" usage:"publish sensor data retained"`
+			Heartbeat bool `default:"false" usage:"publish heartbeat messages retained"`
+		}
+		Commands struct {
+			Actuators []string `usage:"comma separated list of actuators which can be controlled by mqtt commands, * for all"`
+			MaxPulse  int      `default:"10" usage:"maximum duration of a PULSE command in seconds"`
+		}
+		Payload struct {
+			Format   string `default:"json" usage:"payload format of the SENSOR topic: json, tasmota or template"`
+			Template string `usage:"path of the text/template file rendering the payload with the template format"`
+			Scalar   bool   `default:"false" usage:"additionally publish the value of each metric to <prefix>/<clientid>/<metric>"`
+		}
+		Buffer struct {
+			Size int `default:"10000" usage:"number of messages buffered in the embedded datastore while the broker is unreachable, 0 to disable buffering"`
+		}
+		Discovery struct {
+			Enabled bool   `default:"false" usage:"publish home assistant mqtt discovery messages"`
+			Prefix  string `default:"homeassistant" usage:"home assistant mqtt discovery prefix"`
+		}
 	}
 }
 
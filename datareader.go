@@ -2,21 +2,33 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/sink"
 	"github.com/denkhaus/sensor/store"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/pkg/errors"
 	"go.bug.st/serial"
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	ChannelSize = 100
-)
+// register is a modbus holding register of the soil sensor, which holds the raw value of a metric.
+type register struct {
+	metric  store.DataID
+	request []byte
+}
+
+// device returns the device of the metric held by the register.
+func (r register) device() string {
+	if metric, ok := store.LookupMetric(r.metric.String()); ok && metric.Device != "" {
+		return metric.Device
+	}
+
+	return store.DeviceSoilSensor
+}
 
 var (
 	// Humidity:     01 03 00 00 00 01 84 0a
@@ -25,45 +37,63 @@ var (
 	// Salinity:     01 03 00 03 00 01 74 0a
 	// TDS:          01 03 00 04 00 01 c5 cb
 
-	sendData = [][]byte{
-		{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0a},
-		{0x01, 0x03, 0x00, 0x01, 0x00, 0x01, 0xd5, 0xca},
-		{0x01, 0x03, 0x00, 0x02, 0x00, 0x01, 0x25, 0xca},
-		{0x01, 0x03, 0x00, 0x03, 0x00, 0x01, 0x74, 0x0a},
-		{0x01, 0x03, 0x00, 0x04, 0x00, 0x01, 0xc5, 0xcb},
+	registers = []register{
+		{metric: store.Humidity, request: []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0a}},
+		{metric: store.Temperature, request: []byte{0x01, 0x03, 0x00, 0x01, 0x00, 0x01, 0xd5, 0xca}},
+		{metric: store.Conductivity, request: []byte{0x01, 0x03, 0x00, 0x02, 0x00, 0x01, 0x25, 0xca}},
+		{metric: store.Salinity, request: []byte{0x01, 0x03, 0x00, 0x03, 0x00, 0x01, 0x74, 0x0a}},
+		{metric: store.TDS, request: []byte{0x01, 0x03, 0x00, 0x04, 0x00, 0x01, 0xc5, 0xcb}},
 	}
 )
 
 type DataReader struct {
 	port serial.Port
+	sink sink.Sink
+
+	mutex       sync.Mutex
+	lastReading time.Time
 }
 
 func NewDataReader(port serial.Port) *DataReader {
+	// the counters of each device are exported from the start, not after the first failure
+	for _, reg := range registers {
+		device := reg.device()
+		metrics.ModbusRequests.WithLabelValues(device)
+		metrics.ModbusErrors.WithLabelValues(device)
+		metrics.ModbusCRCErrors.WithLabelValues(device)
+		metrics.ModbusTimeouts.WithLabelValues(device)
+	}
+
 	reader := DataReader{port: port}
 	return &reader
 }
 
-// readSensorData reads sensor data from the specified dataID and returns the received data as a byte slice.
+// SetSink sets the sink the snapshots of each poll cycle are written to.
+func (p *DataReader) SetSink(sink sink.Sink) {
+	p.sink = sink
+}
+
+// readSensorData reads the given register from the sensor and returns the received data as a byte slice.
 //
 // Parameters:
-// - dataID: the ID of the data to be read from the sensor.
+// - reg: the register to be read from the sensor.
 //
 // Returns:
 // - []byte: the received data as a byte slice.
-// - error: an error if the dataReader is nil, the dataID is invalid, or there is an error writing or reading data from the sensor.
+// - error: an error if the dataReader is nil or there is an error writing or reading data from the sensor.
 
-func (p *DataReader) readSensorData(dataID store.DataID) ([]byte, error) {
+func (p *DataReader) readSensorData(reg register) ([]byte, error) {
 	if p == nil {
 		return nil, errors.New("dataReader is nil")
 	}
 
-	if dataID < 0 || dataID >= store.DataID(len(sendData)) {
-		return nil, errors.Errorf("invalid dataID: %d", dataID)
-	}
+	device := reg.device()
+	metrics.ModbusRequests.WithLabelValues(device).Inc()
 
-	dataToSend := sendData[dataID]
+	dataToSend := reg.request
 	_, err := p.port.Write(dataToSend)
 	if err != nil {
+		metrics.ModbusErrors.WithLabelValues(device).Inc()
 		return nil, errors.Errorf("can't write data to sensor: %v", err)
 	}
 
@@ -72,10 +102,13 @@ func (p *DataReader) readSensorData(dataID store.DataID) ([]byte, error) {
 	buff := make([]byte, 8)
 	n, err := p.port.Read(buff)
 	if err != nil {
+		metrics.ModbusErrors.WithLabelValues(device).Inc()
 		return nil, errors.Errorf("can't read data from sensor: %v", err)
 	}
 
 	if n == 0 {
+		metrics.ModbusErrors.WithLabelValues(device).Inc()
+		metrics.ModbusTimeouts.WithLabelValues(device).Inc()
 		return nil, errors.New("EOF received")
 	}
 
@@ -83,83 +116,95 @@ func (p *DataReader) readSensorData(dataID store.DataID) ([]byte, error) {
 	logger.Debugf("tx: %s", spew.Sprint(dataToSend))
 	logger.Debugf("rx: %s", spew.Sprint(result))
 
+	if err := checkFrame(result); err != nil {
+		metrics.ModbusErrors.WithLabelValues(device).Inc()
+		metrics.ModbusCRCErrors.WithLabelValues(device).Inc()
+		return nil, err
+	}
+
 	return result, nil
 }
 
+// linkStatus reports whether the last complete poll cycle is recent and when it was received.
+func (p *DataReader) linkStatus(config *config.Config) func() (bool, time.Time) {
+	// a poll cycle may take up to a read timeout per register
+	maxAge := time.Second * time.Duration(2*config.UpdateInterval+len(registers)*config.Usb.ReadTimeout)
+
+	return func() (bool, time.Time) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		up := !p.lastReading.IsZero() && time.Since(p.lastReading) < maxAge
+		return up, p.lastReading
+	}
+}
+
 // process runs the data reading process.
 //
-// It takes a configuration and error group as parameters.
-// Returns an error.
+// It starts the sink and writes a snapshot of all metrics to it after each poll cycle.
+// The sink is closed when reading stops.
+// Returns an error if the sink can't be started.
 func (p *DataReader) process(
 	ctx context.Context,
 	config *config.Config,
 	eg *errgroup.Group,
 ) error {
 
-	comChan := make(chan SensorData, ChannelSize)
 	durUpdateInterval := time.Second * time.Duration(config.UpdateInterval)
 
+	if err := p.sink.Start(ctx); err != nil {
+		return err
+	}
+
 	eg.Go(func() error {
 		ticker := time.NewTicker(durUpdateInterval)
+		defer ticker.Stop()
+		defer p.sink.Close()
 
 		for range ticker.C {
-			for dataID := store.DataID(0); dataID < store.DataID(len(sendData)); dataID++ {
-				rec, err := p.readSensorData(dataID)
+			// the responses are decoded together, a snapshot never mixes two cycles
+			cycle := make([]SensorData, 0, len(registers))
+			for _, reg := range registers {
+				rec, err := p.readSensorData(reg)
+				if errors.Is(err, errCRC) {
+					logger.Warnf("data-reader: %v in response for %s -> skipped", err, reg.metric)
+					continue
+				}
 				if err != nil {
-					ticker.Stop()
-					close(comChan)
-					return errors.Wrapf(err, "error reading sensor data for id %d", dataID)
+					return errors.Wrapf(err, "error reading sensor data for %s", reg.metric)
 				}
 
 				select {
 				case <-ctx.Done():
-					ticker.Stop()
-					close(comChan)
 					logger.Info("data-reader: done received -> closing")
 					return nil
 				default:
-					data := SensorData{id: dataID, data: rec}
-					// decode data here to ensure, data is written to the store
-					data.Decode()
-					if len(comChan) == ChannelSize {
-						logger.Warn("sensor data channel is full, dropping data")
-					} else {
-						comChan <- data
-					}
+					cycle = append(cycle, SensorData{id: reg.metric, data: rec})
 				}
 			}
-		}
-		return nil
-	})
 
-	eg.Go(func() error {
-		opts := mqtt.NewClientOptions().AddBroker(config.Mqtt.Endpoint)
-		opts.SetClientID(config.Mqtt.ClientID).
-			SetUsername(config.Mqtt.Username).
-			SetPassword(config.Mqtt.Password)
-
-		client := mqtt.NewClient(opts)
-		if token := client.Connect(); token.Wait() && token.Error() != nil {
-			return errors.Wrap(token.Error(), "mqtt connect error")
-		}
+			store.Update(func(batch store.Batch) {
+				for _, data := range cycle {
+					data.Decode(batch)
+				}
+			})
 
-		qos := 0
-		for sensorData := range comChan {
-			topic := fmt.Sprintf("%s/%s/SENSOR", config.Mqtt.TopicPrefix, config.Mqtt.ClientID)
-			val, err := sensorData.Payload()
-			if err != nil {
-				return errors.Wrapf(err, "mqtt payload error for topic %s", topic)
+			// a cycle without valid response doesn't prove the link is up
+			if len(cycle) > 0 {
+				p.mutex.Lock()
+				p.lastReading = time.Now()
+				p.mutex.Unlock()
 			}
 
-			token := client.Publish(topic, byte(qos), false, val)
-			if token.Wait() && token.Error() != nil {
-				return errors.Wrapf(token.Error(), "mqtt publish error for topic %s", topic)
+			snapshot := store.Sensor().Snapshot()
+			if err := store.AppendHistory(store.Embedded(), snapshot); err != nil {
+				logger.Warnf("data-reader: %v", err)
 			}
 
-			logger.Debugf("mqtt:sent->%s: %v", topic, val)
+			if err := p.sink.Publish(snapshot); err != nil {
+				logger.Warnf("data-reader: %v", err)
+			}
 		}
-
-		logger.Info("mqtt-writer: channel closed -> closing")
 		return nil
 	})
 
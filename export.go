@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+)
+
+// historyWriter writes HistoryRecords in a specific output format.
+type historyWriter interface {
+	Write(rec *store.HistoryRecord) error
+	Close() error
+}
+
+// parseExportTime parses a time given either as RFC3339 or as a plain date.
+func parseExportTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time %q, use RFC3339 or YYYY-MM-DD", value)
+	}
+
+	return t, nil
+}
+
+// exportCommand streams the persisted sensor history as csv, json or parquet.
+//
+// The embedded store is opened read-only, so the command can be used while the service is running.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := fs.String("from", "", "start of the exported range, RFC3339 or YYYY-MM-DD (default: everything)")
+	to := fs.String("to", "", "end of the exported range (exclusive), RFC3339 or YYYY-MM-DD (default: now)")
+	metrics := fs.String("metrics", "", "comma separated list of metrics to export (default: all)")
+	format := fs.String("format", "csv", "output format: csv, json or parquet")
+	output := fs.String("output", "", "output file (default: stdout)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var err error
+	var fromTime time.Time
+	toTime := time.Now()
+
+	if *from != "" {
+		if fromTime, err = parseExportTime(*from); err != nil {
+			return errors.Wrap(err, "from")
+		}
+	}
+	if *to != "" {
+		if toTime, err = parseExportTime(*to); err != nil {
+			return errors.Wrap(err, "to")
+		}
+	}
+
+	names, err := exportMetricNames(*metrics)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return errors.Wrap(err, "create output file")
+		}
+		defer file.Close()
+		out = file
+	}
+
+	buf := bufio.NewWriter(out)
+	defer buf.Flush()
+
+	var writer historyWriter
+	switch *format {
+	case "csv":
+		writer = newCsvHistoryWriter(buf, names)
+	case "json":
+		writer = newJsonHistoryWriter(buf, names)
+	case "parquet":
+		writer = newParquetHistoryWriter(buf, names)
+	default:
+		return errors.Errorf("unknown format %q", *format)
+	}
+
+	storage := store.NewReadOnlyEmbeddedStore(cnf.Storage.Id)
+	if err := storage.Open(); err != nil {
+		return errors.Wrap(err, "open storage")
+	}
+	defer storage.Close()
+
+	if err := store.ForEachHistory(storage, fromTime, toTime, writer.Write); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, "close writer")
+	}
+
+	return buf.Flush()
+}
+
+// exportMetricNames validates the given comma separated metric names.
+// An empty list selects all metrics.
+func exportMetricNames(list string) ([]string, error) {
+	known := make(map[string]bool)
+	all := []string{}
+	for _, metric := range store.Metrics() {
+		known[metric.ID.String()] = true
+		all = append(all, metric.ID.String())
+	}
+
+	if list == "" {
+		return all, nil
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return nil, errors.Errorf("unknown metric %q, available: %s", name, strings.Join(all, ","))
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+type csvHistoryWriter struct {
+	w      *csv.Writer
+	names  []string
+	header bool
+}
+
+func newCsvHistoryWriter(w io.Writer, names []string) historyWriter {
+	return &csvHistoryWriter{w: csv.NewWriter(w), names: names}
+}
+
+func (p *csvHistoryWriter) Write(rec *store.HistoryRecord) error {
+	if !p.header {
+		if err := p.w.Write(append([]string{"time"}, p.names...)); err != nil {
+			return err
+		}
+		p.header = true
+	}
+
+	row := make([]string, 0, len(p.names)+1)
+	row = append(row, rec.Time.Format(time.RFC3339))
+	for _, name := range p.names {
+		if value, ok := rec.Values[name]; ok {
+			row = append(row, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			row = append(row, "")
+		}
+	}
+
+	return p.w.Write(row)
+}
+
+func (p *csvHistoryWriter) Close() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+type jsonHistoryWriter struct {
+	w     io.Writer
+	names []string
+	count int
+}
+
+func newJsonHistoryWriter(w io.Writer, names []string) historyWriter {
+	return &jsonHistoryWriter{w: w, names: names}
+}
+
+func (p *jsonHistoryWriter) Write(rec *store.HistoryRecord) error {
+	data := map[string]interface{}{
+		"time": rec.Time.Format(time.RFC3339),
+	}
+	for _, name := range p.names {
+		if value, ok := rec.Values[name]; ok {
+			data[name] = value
+		}
+	}
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if p.count == 0 {
+		sep = "[\n"
+	}
+	p.count++
+
+	if _, err := io.WriteString(p.w, sep); err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(buf)
+	return err
+}
+
+func (p *jsonHistoryWriter) Close() error {
+	end := "\n]\n"
+	if p.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(p.w, end)
+	return err
+}
+
+type parquetHistoryWriter struct {
+	w       *parquet.Writer
+	names   []string
+	columns map[string]int
+}
+
+func newParquetHistoryWriter(w io.Writer, names []string) historyWriter {
+	group := parquet.Group{
+		"time": parquet.Timestamp(parquet.Millisecond),
+	}
+	for _, name := range names {
+		group[name] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+
+	schema := parquet.NewSchema("sensor_history", group)
+
+	// parquet orders the columns of a group by name
+	columns := make(map[string]int)
+	for idx, path := range schema.Columns() {
+		columns[path[0]] = idx
+	}
+
+	return &parquetHistoryWriter{
+		w:       parquet.NewWriter(w, schema),
+		names:   names,
+		columns: columns,
+	}
+}
+
+func (p *parquetHistoryWriter) Write(rec *store.HistoryRecord) error {
+	row := make(parquet.Row, len(p.columns))
+	row[p.columns["time"]] = parquet.Int64Value(rec.Time.UnixMilli()).Level(0, 0, p.columns["time"])
+
+	for _, name := range p.names {
+		idx := p.columns[name]
+		if value, ok := rec.Values[name]; ok {
+			row[idx] = parquet.DoubleValue(value).Level(0, 1, idx)
+		} else {
+			row[idx] = parquet.NullValue().Level(0, 0, idx)
+		}
+	}
+
+	_, err := p.w.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (p *parquetHistoryWriter) Close() error {
+	return p.w.Close()
+}
@@ -1,8 +1,10 @@
 package io
 
 import (
+	"context"
 	"time"
 
+	"github.com/denkhaus/sensor/clock"
 	"github.com/pkg/errors"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/host/v3"
@@ -50,30 +52,42 @@ func (p *Pin) SetLow() error {
 }
 
 func (p *Pin) PulseHigh(dur time.Duration) error {
-	if err := p.SetHigh(); err != nil {
-		return err
-	}
+	return p.PulseHighContext(context.Background(), dur)
+}
 
-	time.Sleep(dur)
+func (p *Pin) PulseLow(dur time.Duration) error {
+	return p.PulseLowContext(context.Background(), dur)
+}
 
-	if err := p.SetLow(); err != nil {
-		return err
-	}
+// PulseHighContext sets the pin high for dur. The pulse ends early when ctx is done,
+// in this case the pin is set low and the error of ctx is returned.
+func (p *Pin) PulseHighContext(ctx context.Context, dur time.Duration) error {
+	return p.pulse(ctx, dur, gpio.High)
+}
 
-	return nil
+// PulseLowContext sets the pin low for dur. The pulse ends early when ctx is done,
+// in this case the pin is set high and the error of ctx is returned.
+func (p *Pin) PulseLowContext(ctx context.Context, dur time.Duration) error {
+	return p.pulse(ctx, dur, gpio.Low)
 }
-func (p *Pin) PulseLow(dur time.Duration) error {
-	if err := p.SetLow(); err != nil {
+
+func (p *Pin) pulse(ctx context.Context, dur time.Duration, level gpio.Level) error {
+	if err := p.SetState(level); err != nil {
 		return err
 	}
 
-	time.Sleep(dur)
+	var aborted error
+	select {
+	case <-clock.After(dur):
+	case <-ctx.Done():
+		aborted = errors.Wrapf(ctx.Err(), "pulse of pin %s aborted", p.name)
+	}
 
-	if err := p.SetHigh(); err != nil {
+	if err := p.SetState(!level); err != nil {
 		return err
 	}
 
-	return nil
+	return aborted
 }
 
 func (p *Pin) Close() error {
@@ -85,5 +99,5 @@ func (p *Pin) GetState() gpio.Level {
 }
 
 func NewPin(pin gpio.PinIO) *Pin {
-	return &Pin{PinIO: pin}
+	return &Pin{PinIO: pin, name: pin.Name()}
 }
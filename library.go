@@ -0,0 +1,36 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/denkhaus/sensor/script"
+)
+
+// libraryFiles holds the helper packages of the scripts compiled into the binary.
+//
+//go:embed lib
+var libraryFiles embed.FS
+
+// setupLibrary makes the packages below lib importable by the scripts.
+// Without packages the library is skipped, so $GOPATH/src stays the fallback.
+func setupLibrary() error {
+	lib, err := fs.Sub(libraryFiles, "lib")
+	if err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(lib, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			script.SetLibrary(lib)
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -40,3 +40,32 @@ func SwitchLogLevel(logLevel string) {
 func Logger() *logrus.Logger {
 	return logger
 }
+
+// prefixFormatter prepends a prefix to the message of each entry.
+type prefixFormatter struct {
+	prefix    string
+	formatter logrus.Formatter
+}
+
+func (p *prefixFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	prefixed := *entry
+	prefixed.Message = p.prefix + entry.Message
+	return p.formatter.Format(&prefixed)
+}
+
+// Prefixed returns a logger writing to the service logger with prefix prepended to each message.
+//
+// Parameters:
+// - prefix: the prefix of the messages, e.g. the name of a script.
+//
+// Returns:
+// - *logrus.Logger: a logger with the output, hooks and level of the service logger.
+func Prefixed(prefix string) *logrus.Logger {
+	return &logrus.Logger{
+		Out:       logger.Out,
+		Hooks:     logger.Hooks,
+		Formatter: &prefixFormatter{prefix: prefix, formatter: logger.Formatter},
+		Level:     logger.GetLevel(),
+		ExitFunc:  logger.ExitFunc,
+	}
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/denkhaus/sensor/config"
 	"github.com/denkhaus/sensor/logging"
+	"github.com/denkhaus/sensor/metrics"
 	"github.com/denkhaus/sensor/script"
+	"github.com/denkhaus/sensor/sink"
 	"github.com/denkhaus/sensor/store"
 	"github.com/pkg/errors"
 
@@ -114,6 +117,17 @@ func main() {
 
 	logging.SwitchLogLevel(cnf.LogLevel)
 
+	if err := setupLibrary(); err != nil {
+		logger.Fatalf("script library: %v", err)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			logger.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		os.Exit(0)
+	}
+
 	eg, ctx := errgroup.WithContext(context.Background())
 
 	port, err := startup(&cnf)
@@ -128,12 +142,40 @@ func main() {
 
 	defer storage.Close()
 
+	if cnf.Metrics.Listen != "" {
+		if err := metrics.Serve(ctx, logger, cnf.Metrics.Listen, eg); err != nil {
+			logger.Fatalf("start metrics server: %v", err)
+		}
+	}
+
 	r := NewDataReader(port)
+
+	sinks, mqttBroker, err := createSinks(&cnf, r)
+	if err != nil {
+		logger.Fatalf("create sinks: %v", err)
+	}
+
+	// the scripts receive each snapshot like a sink
+	sinks = append(sinks, script.NewEventSink())
+	dispatcher := sink.NewDispatcher(logger, cnf.Sinks.Buffer, sinks...)
+	r.SetSink(dispatcher)
+
 	if err := r.process(ctx, &cnf, eg); err != nil {
 		logger.Fatalf("process data: %v", err)
 	}
 
-	if err := script.Initialize(ctx, logger, &cnf, eg); err != nil {
+	if cnf.Api.Enabled {
+		if err := serveApi(ctx, &cnf, r, dispatcher, eg); err != nil {
+			logger.Fatalf("start api server: %v", err)
+		}
+	}
+
+	var connection script.MqttConnection
+	if mqttBroker != nil {
+		connection = mqttBroker
+	}
+
+	if err := script.Initialize(ctx, logger, &cnf, connection, eg); err != nil {
 		logger.Fatalf("initialize scriptrunner: %v", err)
 	}
 
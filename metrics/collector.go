@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sensorCollector exports a consistent snapshot of all metrics of the SensorStore.
+type sensorCollector struct {
+	value   *prometheus.Desc
+	raw     *prometheus.Desc
+	updated *prometheus.Desc
+	quality *prometheus.Desc
+}
+
+func newSensorCollector() prometheus.Collector {
+	labels := []string{"metric", "device", "unit"}
+	return &sensorCollector{
+		value: prometheus.NewDesc("sensor_value",
+			"Averaged value of a metric.", labels, nil),
+		raw: prometheus.NewDesc("sensor_raw_value",
+			"Last raw value of a metric.", labels, nil),
+		updated: prometheus.NewDesc("sensor_updated_timestamp_seconds",
+			"Time of the last update of a metric.", labels, nil),
+		quality: prometheus.NewDesc("sensor_quality",
+			"Quality of a metric, 1 for the current quality.", []string{"metric", "quality"}, nil),
+	}
+}
+
+func (p *sensorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.value
+	ch <- p.raw
+	ch <- p.updated
+	ch <- p.quality
+}
+
+func (p *sensorCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, reading := range store.Sensor().Snapshot().Readings() {
+		metric := reading.Metric
+		ch <- prometheus.MustNewConstMetric(p.quality, prometheus.GaugeValue, 1,
+			metric.ID.String(), reading.Quality.String(),
+		)
+
+		if reading.Quality == store.QualityMissing {
+			continue
+		}
+
+		labels := []string{metric.ID.String(), metric.Device, metric.Unit}
+		ch <- prometheus.MustNewConstMetric(p.value, prometheus.GaugeValue, reading.Value, labels...)
+		ch <- prometheus.MustNewConstMetric(p.raw, prometheus.GaugeValue, reading.Raw, labels...)
+		ch <- prometheus.MustNewConstMetric(p.updated, prometheus.GaugeValue,
+			float64(reading.Updated.UnixNano())/1e9, labels...,
+		)
+	}
+}
+
+// actuatorCollector exports the state, on-time and pulse count of each Actuator.
+type actuatorCollector struct {
+	on     *prometheus.Desc
+	manual *prometheus.Desc
+	onTime *prometheus.Desc
+	pulses *prometheus.Desc
+}
+
+func newActuatorCollector() prometheus.Collector {
+	labels := []string{"actuator"}
+	return &actuatorCollector{
+		on: prometheus.NewDesc("sensor_actuator_on",
+			"1 if the actuator is active.", labels, nil),
+		manual: prometheus.NewDesc("sensor_actuator_manual",
+			"1 if the actuator is driven by commands instead of its timer.", labels, nil),
+		onTime: prometheus.NewDesc("sensor_actuator_on_seconds_total",
+			"Total time the actuator was active.", labels, nil),
+		pulses: prometheus.NewDesc("sensor_actuator_pulses_total",
+			"Number of pulses of the actuator.", labels, nil),
+	}
+}
+
+func (p *actuatorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.on
+	ch <- p.manual
+	ch <- p.onTime
+	ch <- p.pulses
+}
+
+func (p *actuatorCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, act := range types.Actuators().List() {
+		ch <- prometheus.MustNewConstMetric(p.on, prometheus.GaugeValue, boolValue(act.IsOn()), act.Name)
+		ch <- prometheus.MustNewConstMetric(p.manual, prometheus.GaugeValue,
+			boolValue(act.Mode() == types.ActuatorModeManual), act.Name,
+		)
+		ch <- prometheus.MustNewConstMetric(p.onTime, prometheus.CounterValue, act.OnTime().Seconds(), act.Name)
+		ch <- prometheus.MustNewConstMetric(p.pulses, prometheus.CounterValue, float64(act.Pulses()), act.Name)
+	}
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
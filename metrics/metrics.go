@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "sensor"
+
+var (
+	// ModbusRequests counts the requests sent to the sensors by device.
+	ModbusRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "modbus_requests_total",
+		Help:      "Number of modbus requests sent to the sensors.",
+	}, []string{"device"})
+	// ModbusErrors counts all failed requests by device, including timeouts and crc errors.
+	ModbusErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "modbus_errors_total",
+		Help:      "Number of failed modbus requests.",
+	}, []string{"device"})
+	// ModbusCRCErrors counts responses with an invalid checksum by device.
+	ModbusCRCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "modbus_crc_errors_total",
+		Help:      "Number of modbus responses with an invalid crc.",
+	}, []string{"device"})
+	// ModbusTimeouts counts requests without response by device.
+	ModbusTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "modbus_timeouts_total",
+		Help:      "Number of modbus requests without response.",
+	}, []string{"device"})
+
+	// MqttPublished counts mqtt publishes by result "success" or "failure".
+	MqttPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_publish_total",
+		Help:      "Number of mqtt publishes by result.",
+	}, []string{"result"})
+
+	// ScriptDuration observes the duration of each script run by script.
+	ScriptDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "script_duration_seconds",
+		Help:      "Duration of the script runs.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"script"})
+	// ScriptErrors counts script and setup runs returning an error or panicking by script.
+	ScriptErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "script_errors_total",
+		Help:      "Number of failed script runs.",
+	}, []string{"script"})
+	// ScriptOverruns counts script and setup runs exceeding their timeout by script.
+	ScriptOverruns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "script_overruns_total",
+		Help:      "Number of script runs exceeding their timeout.",
+	}, []string{"script"})
+
+	// Dropped counts items dropped because a buffer was full, by buffer.
+	Dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_total",
+		Help:      "Number of items dropped because a buffer was full.",
+	}, []string{"buffer"})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ModbusRequests,
+		ModbusErrors,
+		ModbusCRCErrors,
+		ModbusTimeouts,
+		MqttPublished,
+		ScriptDuration,
+		ScriptErrors,
+		ScriptOverruns,
+		Dropped,
+		newSensorCollector(),
+		newActuatorCollector(),
+	)
+}
+
+// Registry returns the registry holding all metrics of the service.
+func Registry() *prometheus.Registry {
+	return registry
+}
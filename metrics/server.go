@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Serve serves the metrics on http://<listen>/metrics until ctx is done.
+//
+// Parameters:
+// - ctx: the context stopping the server.
+// - logger: the logger to use.
+// - listen: the address to listen on, e.g. ":9101".
+// - eg: the errgroup running the server.
+//
+// Returns:
+// - error: an error if the address can't be listened on.
+func Serve(ctx context.Context, logger *logrus.Logger, listen string, eg *errgroup.Group) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// listen before returning, so a busy port is reported on startup
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return errors.Wrap(err, "listen for metrics server")
+	}
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		logger.Info("metrics-server: done received -> closing")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	})
+
+	eg.Go(func() error {
+		logger.Infof("metrics-server: listening on %s", listen)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return errors.Wrap(err, "metrics server")
+		}
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// errCRC is returned for a response with an invalid checksum, which is skipped.
+var errCRC = errors.New("invalid crc")
+
+// modbusCRC returns the crc16 checksum of a modbus rtu frame.
+func modbusCRC(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// checkFrame returns errCRC if frame is too short or its checksum doesn't match.
+func checkFrame(frame []byte) error {
+	n := len(frame)
+
+	// address, function, byte count, value and crc
+	if n < 7 || modbusCRC(frame[:n-2]) != binary.LittleEndian.Uint16(frame[n-2:]) {
+		return errCRC
+	}
+
+	return nil
+}
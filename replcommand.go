@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"os"
+
+	"github.com/denkhaus/sensor/script"
+	"github.com/pkg/errors"
+)
+
+// replCommand connects to the repl socket of the running service and forwards stdin and stdout.
+// The session is read-only unless -actuators is given and the service allows it with -repl-actuators.
+func replCommand(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	actuators := fs.Bool("actuators", false, "allow the session to switch actuators, publish mqtt messages and write to the stores")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cnf.Repl.Socket == "" {
+		return errors.New("no repl socket, set -repl-socket like the running service")
+	}
+
+	conn, err := net.Dial("unix", cnf.Repl.Socket)
+	if err != nil {
+		return errors.Wrap(err, "connect to the service")
+	}
+	defer conn.Close()
+
+	hello, err := json.Marshal(script.ReplHello{Actuators: *actuators})
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(append(hello, '\n')); err != nil {
+		return errors.Wrap(err, "open session")
+	}
+
+	// the session ends when stdin is closed or the service closes the connection
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.(*net.UnixConn).CloseWrite()
+	}()
+
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		return errors.Wrap(err, "read session")
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package script
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/denkhaus/sensor/symbols"
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+// CheckError is a problem of a script at a position.
+type CheckError struct {
+	Pos     token.Position
+	Message string
+}
+
+// Error returns the error as file:line:column: message.
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Check validates the script at path without running any of its code.
+//
+// The script and the helper packages it imports are parsed and type-checked against the symbols
+// available to the service, and the signatures of Setup, Script, the event entrypoints and the
+// optional variables are verified. Neither package level initializers nor init functions are run.
+//
+// Parameters:
+// - path: the path of the script.
+// - lib: the helper packages importable by the script, may be nil.
+//
+// Returns:
+// - []*CheckError: all problems found sorted by position, empty if the script is valid.
+// - error: an error if the script could not be read.
+func Check(path string, lib fs.FS) ([]*CheckError, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read script")
+	}
+
+	var problems []*CheckError
+	report := func(err error) {
+		var list scanner.ErrorList
+		var typeErr types.Error
+		switch {
+		case errors.As(err, &list):
+			for _, e := range list {
+				problems = append(problems, &CheckError{Pos: e.Pos, Message: e.Msg})
+			}
+		case errors.As(err, &typeErr):
+			problems = append(problems, &CheckError{Pos: typeErr.Fset.Position(typeErr.Pos), Message: typeErr.Msg})
+		default:
+			problems = append(problems, &CheckError{Pos: token.Position{Filename: path}, Message: err.Error()})
+		}
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.AllErrors)
+	if err != nil {
+		report(err)
+		return problems, nil
+	}
+
+	importer := newSymbolImporter(fset, lib, report, stdlib.Symbols, symbols.Symbols)
+	conf := types.Config{Importer: importer, Error: report}
+	// the problems are reported by conf.Error
+	pkg, _ := conf.Check(file.Name.Name, fset, []*ast.File{file}, nil)
+
+	decls := declChecker{importer: importer, scope: pkg.Scope(), fset: fset, file: file, path: path}
+	problems = append(problems, decls.check()...)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Pos, problems[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return problems, nil
+}
+
+// declChecker verifies the package level declarations of a type-checked script
+// with the rules NewScriptRunner applies to the evaluated script.
+type declChecker struct {
+	importer *symbolImporter
+	scope    *types.Scope
+	fset     *token.FileSet
+	file     *ast.File
+	path     string
+}
+
+// check returns the problems of the entrypoints and optional variables.
+func (c declChecker) check() []*CheckError {
+	var problems []*CheckError
+	problemf := func(name string, format string, args ...interface{}) {
+		pos, ok := declPos(c.fset, c.file, name)
+		if !ok {
+			pos = token.Position{Filename: c.path}
+		}
+		problems = append(problems, &CheckError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range []string{"Script", "Setup"} {
+		if typ, ok := c.lookup(name); !ok {
+			problemf(name, "missing %s entrypoint", name)
+		} else if !c.is(typ, entrypointType) {
+			problemf(name, "%s must be a %s", name, entrypointType)
+		}
+	}
+
+	if typ, ok := c.lookup("RunInterval"); ok {
+		if !c.is(typ, reflect.TypeOf(time.Duration(0))) {
+			problemf("RunInterval", "RunInterval must be a positive time.Duration")
+		} else if value, ok := c.constant("RunInterval"); ok && constant.Sign(value) <= 0 {
+			problemf("RunInterval", "RunInterval must be a positive time.Duration")
+		}
+	}
+
+	if typ, ok := c.lookup("Enabled"); ok && !c.is(typ, reflect.TypeOf(true)) {
+		problemf("Enabled", "Enabled must be a bool")
+	}
+
+	names := make([]string, 0, len(entrypointTypes))
+	for name := range entrypointTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if typ, ok := c.lookup(name); ok && !c.is(typ, entrypointTypes[name]) {
+			problemf(name, "%s must be a %s", name, entrypointTypes[name])
+		}
+	}
+
+	if typ, ok := c.lookup("MqttTopics"); ok {
+		if !c.is(typ, reflect.TypeOf([]string(nil))) {
+			problemf("MqttTopics", "MqttTopics must be a []string")
+		} else if _, ok := c.lookup(EntrypointOnMqttMessage); !ok && !c.empty("MqttTopics") {
+			problemf("MqttTopics", "MqttTopics requires an OnMqttMessage entrypoint")
+		}
+	}
+
+	return problems
+}
+
+// lookup returns the type of the package level function, variable or constant name, nil for a type name.
+func (c declChecker) lookup(name string) (types.Type, bool) {
+	switch obj := c.scope.Lookup(name).(type) {
+	case *types.Func, *types.Var, *types.Const:
+		return obj.Type(), true
+	case *types.TypeName:
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// is reports whether a value of typ is of the type want in the interpreter, untyped constants get their default type.
+// An invalid type already has a problem and is treated as valid.
+func (c declChecker) is(typ types.Type, want reflect.Type) bool {
+	if typ == nil {
+		return false
+	}
+	if typ == types.Typ[types.Invalid] {
+		return true
+	}
+
+	return types.Identical(types.Default(typ), c.importer.typ(want))
+}
+
+// constant returns the value of the package level constant name.
+func (c declChecker) constant(name string) (constant.Value, bool) {
+	if obj, ok := c.scope.Lookup(name).(*types.Const); ok {
+		return obj.Val(), true
+	}
+
+	return nil, false
+}
+
+// empty reports whether the package level variable name has no elements, it is
+// declared without a value or with an empty composite literal.
+func (c declChecker) empty(name string) bool {
+	for _, decl := range c.file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+
+		for _, spec := range decl.Specs {
+			value, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+
+			for i, ident := range value.Names {
+				if ident.Name != name {
+					continue
+				}
+				if len(value.Values) <= i {
+					return true
+				}
+				lit, ok := value.Values[i].(*ast.CompositeLit)
+				return ok && len(lit.Elts) == 0
+			}
+		}
+	}
+
+	return false
+}
+
+// declPos returns the position of the package level function, variable or constant name.
+func declPos(fset *token.FileSet, file *ast.File, name string) (token.Position, bool) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name == name {
+				return fset.Position(decl.Name.Pos()), true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if value, ok := spec.(*ast.ValueSpec); ok {
+					for _, ident := range value.Names {
+						if ident.Name == name {
+							return fset.Position(ident.Pos()), true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return token.Position{}, false
+}
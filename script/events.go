@@ -0,0 +1,368 @@
+package script
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/broker"
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+// eventBuffer is the number of events queued per script.
+const eventBuffer = 16
+
+// entrypointMqttHandler is the name of a handler subscribed by a script in logs and errors.
+const entrypointMqttHandler = "mqtt handler"
+
+// event is a call of an optional entrypoint or mqtt handler queued for a script.
+type event struct {
+	entrypoint string
+	snapshot   store.Snapshot
+	args       []interface{}
+	// client and handler are set for a message on a topic subscribed by the script
+	client  *mqttClient
+	handler types.MqttHandler
+}
+
+// MqttConnection is the mqtt connection shared by the scripts, it is implemented by broker.Broker.
+type MqttConnection interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}, props ...broker.UserProperty) error
+	Subscribe(topic string, qos byte, handler broker.MessageHandler) error
+	Unsubscribe(topic string) error
+}
+
+// instances routes events to the running scripts by name.
+type instances struct {
+	mutex sync.RWMutex
+	list  map[string]*instance
+}
+
+var running = &instances{list: make(map[string]*instance)}
+
+func (p *instances) add(inst *instance) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.list[inst.name] = inst
+}
+
+func (p *instances) get(name string) (*instance, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	inst, ok := p.list[name]
+	return inst, ok
+}
+
+func (p *instances) each(fn func(inst *instance)) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, inst := range p.list {
+		fn(inst)
+	}
+}
+
+// notifyTimer queues OnTimer for the script owning the timer.
+func notifyTimer(script string, timer string) {
+	if inst, ok := running.get(script); ok {
+		inst.post(event{entrypoint: EntrypointOnTimer, args: []interface{}{timer}})
+	}
+}
+
+// EventSink queues OnSensorData for all scripts after each poll cycle.
+type EventSink struct{}
+
+// NewEventSink creates the sink calling OnSensorData of the scripts.
+func NewEventSink() *EventSink {
+	return &EventSink{}
+}
+
+func (p *EventSink) Name() string {
+	return "script"
+}
+
+func (p *EventSink) Start(ctx context.Context) error {
+	return nil
+}
+
+func (p *EventSink) Publish(snapshot store.Snapshot) error {
+	running.each(func(inst *instance) {
+		inst.post(event{entrypoint: EntrypointOnSensorData, snapshot: snapshot, args: []interface{}{snapshot}})
+	})
+	return nil
+}
+
+func (p *EventSink) Close() error {
+	return nil
+}
+
+// mqttListeners are the scripts interested in a topic filter.
+type mqttListeners struct {
+	// scripts list the filter in MqttTopics
+	scripts map[*instance]bool
+	// handlers are subscribed by the scripts
+	handlers map[*mqttClient]types.MqttHandler
+	// waiters wait for a retained message
+	waiters []chan []byte
+}
+
+func (l *mqttListeners) empty() bool {
+	return len(l.scripts) == 0 && len(l.handlers) == 0 && len(l.waiters) == 0
+}
+
+// mqttRouter shares the subscriptions of the mqtt connection between the scripts.
+type mqttRouter struct {
+	connection MqttConnection
+	qos        byte
+
+	mutex  sync.Mutex
+	topics map[string]*mqttListeners
+}
+
+func newMqttRouter(connection MqttConnection, qos byte) *mqttRouter {
+	return &mqttRouter{
+		connection: connection,
+		qos:        qos,
+		topics:     make(map[string]*mqttListeners),
+	}
+}
+
+// enabled reports whether there is a mqtt connection.
+func (p *mqttRouter) enabled() bool {
+	return p != nil && p.connection != nil
+}
+
+// Set replaces the topics inst is subscribed to.
+func (p *mqttRouter) Set(inst *instance, topics []string) {
+	if !p.enabled() {
+		if len(topics) > 0 {
+			inst.logger.Warn("script-runner: mqtt is disabled, MqttTopics are ignored")
+		}
+		return
+	}
+
+	subscribe, unsubscribe := p.update(inst, topics)
+
+	// the client may deliver retained messages while subscribing, so don't hold the mutex
+	for _, topic := range unsubscribe {
+		if err := p.connection.Unsubscribe(topic); err != nil {
+			inst.logger.Warnf("script-runner: unsubscribe %s: %v", topic, err)
+		}
+	}
+
+	for _, topic := range subscribe {
+		if err := p.connection.Subscribe(topic, p.qos, p.handler(topic)); err != nil {
+			inst.logger.Warnf("script-runner: subscribe %s: %v", topic, err)
+		}
+	}
+}
+
+// update records the topics of inst and returns the topics to subscribe and unsubscribe.
+func (p *mqttRouter) update(inst *instance, topics []string) ([]string, []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	wanted := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		wanted[topic] = true
+	}
+
+	var subscribe, unsubscribe []string
+	for topic, listeners := range p.topics {
+		if !listeners.scripts[inst] || wanted[topic] {
+			continue
+		}
+
+		delete(listeners.scripts, inst)
+		if p.drop(topic) {
+			unsubscribe = append(unsubscribe, topic)
+		}
+	}
+
+	for topic := range wanted {
+		listeners, created := p.listen(topic)
+		if created {
+			subscribe = append(subscribe, topic)
+		}
+
+		listeners.scripts[inst] = true
+	}
+
+	return subscribe, unsubscribe
+}
+
+// listen returns the listeners of the topic filter, created reports whether it has to be subscribed.
+// The caller must hold the mutex.
+func (p *mqttRouter) listen(filter string) (*mqttListeners, bool) {
+	if listeners, ok := p.topics[filter]; ok {
+		return listeners, false
+	}
+
+	listeners := &mqttListeners{
+		scripts:  make(map[*instance]bool),
+		handlers: make(map[*mqttClient]types.MqttHandler),
+	}
+	p.topics[filter] = listeners
+	return listeners, true
+}
+
+// drop removes the topic filter if nobody listens anymore and reports whether it has to be unsubscribed.
+// The caller must hold the mutex.
+func (p *mqttRouter) drop(filter string) bool {
+	listeners, ok := p.topics[filter]
+	if !ok || !listeners.empty() {
+		return false
+	}
+
+	delete(p.topics, filter)
+	return true
+}
+
+// subscribe calls handler of client for each message on the topic filter.
+//
+// The filter is subscribed again even if other listeners use it, so the broker sends the
+// retained messages to the new handler. The other listeners receive them again.
+func (p *mqttRouter) subscribe(client *mqttClient, filter string, handler types.MqttHandler) error {
+	p.mutex.Lock()
+	listeners, _ := p.listen(filter)
+	listeners.handlers[client] = handler
+	p.mutex.Unlock()
+
+	if err := p.connection.Subscribe(filter, p.qos, p.handler(filter)); err != nil {
+		p.mutex.Lock()
+		delete(listeners.handlers, client)
+		p.drop(filter)
+		p.mutex.Unlock()
+		return errors.Wrapf(err, "subscribe %s", filter)
+	}
+
+	return nil
+}
+
+// unsubscribe removes the handler of client for the topic filter.
+func (p *mqttRouter) unsubscribe(client *mqttClient, filter string) error {
+	p.mutex.Lock()
+	unsubscribe := false
+	if listeners, ok := p.topics[filter]; ok {
+		delete(listeners.handlers, client)
+		unsubscribe = p.drop(filter)
+	}
+	p.mutex.Unlock()
+
+	if !unsubscribe {
+		return nil
+	}
+
+	return errors.Wrapf(p.connection.Unsubscribe(filter), "unsubscribe %s", filter)
+}
+
+// release removes all handlers of client, the script was replaced.
+func (p *mqttRouter) release(client *mqttClient) {
+	if !p.enabled() {
+		return
+	}
+
+	p.mutex.Lock()
+	filters := []string{}
+	for filter, listeners := range p.topics {
+		if _, ok := listeners.handlers[client]; ok {
+			filters = append(filters, filter)
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, filter := range filters {
+		if err := p.unsubscribe(client, filter); err != nil {
+			client.inst.logger.Warnf("script-runner: %v", err)
+		}
+	}
+}
+
+// retained returns the retained message of topic, ok is false if the broker has none.
+//
+// The topic is subscribed until the broker sends the retained message or timeout passes.
+// Messages without retain flag don't count.
+// Like subscribe, the other listeners of the topic receive the retained message again.
+func (p *mqttRouter) retained(topic string, timeout time.Duration) ([]byte, bool, error) {
+	waiter := make(chan []byte, 1)
+
+	p.mutex.Lock()
+	listeners, _ := p.listen(topic)
+	listeners.waiters = append(listeners.waiters, waiter)
+	p.mutex.Unlock()
+
+	var payload []byte
+	found := false
+
+	err := p.connection.Subscribe(topic, p.qos, p.handler(topic))
+	if err == nil {
+		timer := time.NewTimer(timeout)
+		select {
+		case payload = <-waiter:
+			found = true
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	p.mutex.Lock()
+	for idx, ch := range listeners.waiters {
+		if ch == waiter {
+			listeners.waiters = append(listeners.waiters[:idx], listeners.waiters[idx+1:]...)
+			break
+		}
+	}
+	unsubscribe := p.drop(topic)
+	p.mutex.Unlock()
+
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "subscribe %s", topic)
+	}
+
+	if unsubscribe {
+		if err := p.connection.Unsubscribe(topic); err != nil {
+			return payload, found, errors.Wrapf(err, "unsubscribe %s", topic)
+		}
+	}
+
+	return payload, found, nil
+}
+
+// handler queues OnMqttMessage and the handlers of all scripts subscribed to the topic filter.
+func (p *mqttRouter) handler(filter string) broker.MessageHandler {
+	return func(topic string, payload []byte, retained bool) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		listeners, ok := p.topics[filter]
+		if !ok {
+			return
+		}
+
+		for inst := range listeners.scripts {
+			inst.post(event{entrypoint: EntrypointOnMqttMessage, args: []interface{}{topic, payload}})
+		}
+
+		for client, handler := range listeners.handlers {
+			client.inst.post(event{
+				entrypoint: entrypointMqttHandler,
+				args:       []interface{}{topic, payload},
+				client:     client,
+				handler:    handler,
+			})
+		}
+
+		// live messages published meanwhile aren't the retained message
+		if !retained {
+			return
+		}
+
+		for _, waiter := range listeners.waiters {
+			select {
+			case waiter <- payload:
+			default:
+			}
+		}
+	}
+}
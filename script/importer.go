@@ -0,0 +1,370 @@
+package script
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+)
+
+// symbolImporter provides the packages of the interpreter to go/types without evaluating anything.
+//
+// Binary packages are built from the reflect values of the symbol table,
+// source packages of the library are parsed and type-checked.
+type symbolImporter struct {
+	exports interp.Exports
+	lib     fs.FS
+	fset    *token.FileSet
+	// report receives the problems of the source packages
+	report func(err error)
+
+	packages map[string]*types.Package
+	// imported are the results of Import by import path
+	imported map[string]importResult
+	typesOf  map[reflect.Type]types.Type
+}
+
+// importResult is the package or the error of an import.
+type importResult struct {
+	pkg *types.Package
+	err error
+}
+
+// newSymbolImporter returns an importer of the symbols in exports and the source packages in lib.
+func newSymbolImporter(fset *token.FileSet, lib fs.FS, report func(err error), exports ...interp.Exports) *symbolImporter {
+	p := &symbolImporter{
+		exports:  make(interp.Exports),
+		lib:      lib,
+		fset:     fset,
+		report:   report,
+		packages: make(map[string]*types.Package),
+		imported: make(map[string]importResult),
+		typesOf:  make(map[reflect.Type]types.Type),
+	}
+
+	for _, e := range exports {
+		for key, symbols := range e {
+			p.exports[key] = symbols
+		}
+	}
+
+	return p
+}
+
+// Import returns the package of the import path.
+func (p *symbolImporter) Import(importPath string) (*types.Package, error) {
+	if result, ok := p.imported[importPath]; ok {
+		if result.err == nil && !result.pkg.Complete() {
+			return nil, errors.Errorf("import cycle through %s", importPath)
+		}
+		return result.pkg, result.err
+	}
+
+	result := importResult{err: errors.Errorf("package %s is neither exported by the symbols nor part of the script library", importPath)}
+	for key, symbols := range p.exports {
+		if dir, name := path.Split(key); strings.TrimSuffix(dir, "/") == importPath {
+			result = importResult{pkg: p.binaryPackage(importPath, name, symbols)}
+			break
+		}
+	}
+
+	if result.pkg == nil && p.lib != nil {
+		if info, err := fs.Stat(p.lib, importPath); err == nil && info.IsDir() {
+			result = p.sourcePackage(importPath)
+		}
+	}
+
+	p.imported[importPath] = result
+
+	return result.pkg, result.err
+}
+
+// binaryPackage declares the symbols of a package of the symbol table.
+func (p *symbolImporter) binaryPackage(importPath string, name string, symbols map[string]reflect.Value) *types.Package {
+	pkg := p.pkg(importPath)
+	pkg.SetName(name)
+
+	for symbol, value := range symbols {
+		// interface wrappers of the interpreter
+		if strings.HasPrefix(symbol, "_") {
+			continue
+		}
+
+		var obj types.Object
+		switch {
+		case value.Kind() == reflect.Ptr && value.IsNil():
+			t := value.Type().Elem()
+			if t.Name() == symbol && t.PkgPath() == importPath {
+				p.typ(t)
+				continue
+			}
+			obj = types.NewTypeName(token.NoPos, pkg, symbol, p.typ(t))
+		case value.CanAddr():
+			obj = types.NewVar(token.NoPos, pkg, symbol, p.typ(value.Type()))
+		case value.Kind() == reflect.Func:
+			obj = types.NewFunc(token.NoPos, pkg, symbol, p.signature(value.Type(), nil, 0))
+		default:
+			obj = p.constant(pkg, symbol, value)
+		}
+
+		pkg.Scope().Insert(obj)
+	}
+
+	pkg.MarkComplete()
+
+	return pkg
+}
+
+// constant declares an untyped constant of a constant.Value or a typed constant of its value.
+func (p *symbolImporter) constant(pkg *types.Package, name string, value reflect.Value) types.Object {
+	if c, ok := value.Interface().(constant.Value); ok {
+		kinds := map[constant.Kind]types.BasicKind{
+			constant.Bool:    types.UntypedBool,
+			constant.String:  types.UntypedString,
+			constant.Int:     types.UntypedInt,
+			constant.Float:   types.UntypedFloat,
+			constant.Complex: types.UntypedComplex,
+		}
+		return types.NewConst(token.NoPos, pkg, name, types.Typ[kinds[c.Kind()]], c)
+	}
+
+	var c constant.Value
+	switch value.Kind() {
+	case reflect.Bool:
+		c = constant.MakeBool(value.Bool())
+	case reflect.String:
+		c = constant.MakeString(value.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c = constant.MakeInt64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c = constant.MakeUint64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		c = constant.MakeFloat64(value.Float())
+	default:
+		// a value that can't be a constant, e.g. a struct, behaves like a variable
+		return types.NewVar(token.NoPos, pkg, name, p.typ(value.Type()))
+	}
+
+	return types.NewConst(token.NoPos, pkg, name, p.typ(value.Type()), c)
+}
+
+// sourcePackage parses and type-checks a package of the library. Its problems are reported.
+func (p *symbolImporter) sourcePackage(importPath string) importResult {
+	entries, err := fs.ReadDir(p.lib, importPath)
+	if err != nil {
+		return importResult{err: errors.Wrapf(err, "read package %s", importPath)}
+	}
+
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		content, err := fs.ReadFile(p.lib, path.Join(importPath, name))
+		if err != nil {
+			return importResult{err: errors.Wrapf(err, "read package %s", importPath)}
+		}
+
+		file, err := parser.ParseFile(p.fset, path.Join(importPath, name), content, parser.AllErrors)
+		if err != nil {
+			p.report(err)
+			return importResult{err: errors.Errorf("package %s has syntax errors", importPath)}
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return importResult{err: errors.Errorf("package %s has no go files", importPath)}
+	}
+
+	// the incomplete package detects import cycles while it is checked
+	pkg := types.NewPackage(importPath, files[0].Name.Name)
+	p.imported[importPath] = importResult{pkg: pkg}
+
+	conf := types.Config{Importer: p, Error: p.report}
+	// the problems of the package are reported by conf.Error
+	_ = types.NewChecker(&conf, p.fset, pkg, nil).Files(files)
+	pkg.MarkComplete()
+
+	return importResult{pkg: pkg}
+}
+
+// pkg returns the package of the import path, created on first use.
+func (p *symbolImporter) pkg(importPath string) *types.Package {
+	if pkg, ok := p.packages[importPath]; ok {
+		return pkg
+	}
+
+	pkg := types.NewPackage(importPath, path.Base(importPath))
+	p.packages[importPath] = pkg
+
+	return pkg
+}
+
+// typ returns the go/types type of t.
+func (p *symbolImporter) typ(t reflect.Type) types.Type {
+	if typ, ok := p.typesOf[t]; ok {
+		return typ
+	}
+
+	if t.Kind() == reflect.UnsafePointer {
+		return types.Typ[types.UnsafePointer]
+	}
+
+	if t.Name() == "" {
+		typ := p.underlying(t)
+		p.typesOf[t] = typ
+		return typ
+	}
+
+	if t.PkgPath() == "" {
+		typ := types.Universe.Lookup(t.Name()).Type()
+		p.typesOf[t] = typ
+		return typ
+	}
+
+	// the named type is cached before its underlying type, which may refer to it
+	pkg := p.pkg(t.PkgPath())
+	obj := types.NewTypeName(token.NoPos, pkg, t.Name(), nil)
+	named := types.NewNamed(obj, nil, nil)
+	p.typesOf[t] = named
+
+	// instances of generic types can't be named in a script
+	if !strings.Contains(t.Name(), "[") {
+		pkg.Scope().Insert(obj)
+	}
+
+	named.SetUnderlying(p.underlying(t))
+
+	if t.Kind() != reflect.Interface {
+		ptr := reflect.PointerTo(t)
+		for i := 0; i < ptr.NumMethod(); i++ {
+			method := ptr.Method(i)
+
+			var recv types.Type = named
+			if _, ok := t.MethodByName(method.Name); !ok {
+				recv = types.NewPointer(named)
+			}
+
+			sig := p.signature(method.Type, types.NewVar(token.NoPos, pkg, "", recv), 1)
+			named.AddMethod(types.NewFunc(token.NoPos, pkg, method.Name, sig))
+		}
+	}
+
+	return named
+}
+
+// underlying returns the go/types type of the structure of t.
+func (p *symbolImporter) underlying(t reflect.Type) types.Type {
+	switch t.Kind() {
+	case reflect.Bool:
+		return types.Typ[types.Bool]
+	case reflect.Int:
+		return types.Typ[types.Int]
+	case reflect.Int8:
+		return types.Typ[types.Int8]
+	case reflect.Int16:
+		return types.Typ[types.Int16]
+	case reflect.Int32:
+		return types.Typ[types.Int32]
+	case reflect.Int64:
+		return types.Typ[types.Int64]
+	case reflect.Uint:
+		return types.Typ[types.Uint]
+	case reflect.Uint8:
+		return types.Typ[types.Uint8]
+	case reflect.Uint16:
+		return types.Typ[types.Uint16]
+	case reflect.Uint32:
+		return types.Typ[types.Uint32]
+	case reflect.Uint64:
+		return types.Typ[types.Uint64]
+	case reflect.Uintptr:
+		return types.Typ[types.Uintptr]
+	case reflect.Float32:
+		return types.Typ[types.Float32]
+	case reflect.Float64:
+		return types.Typ[types.Float64]
+	case reflect.Complex64:
+		return types.Typ[types.Complex64]
+	case reflect.Complex128:
+		return types.Typ[types.Complex128]
+	case reflect.String:
+		return types.Typ[types.String]
+	case reflect.UnsafePointer:
+		return types.Typ[types.UnsafePointer]
+	case reflect.Array:
+		return types.NewArray(p.typ(t.Elem()), int64(t.Len()))
+	case reflect.Slice:
+		return types.NewSlice(p.typ(t.Elem()))
+	case reflect.Ptr:
+		return types.NewPointer(p.typ(t.Elem()))
+	case reflect.Map:
+		return types.NewMap(p.typ(t.Key()), p.typ(t.Elem()))
+	case reflect.Chan:
+		dirs := map[reflect.ChanDir]types.ChanDir{
+			reflect.BothDir: types.SendRecv,
+			reflect.SendDir: types.SendOnly,
+			reflect.RecvDir: types.RecvOnly,
+		}
+		return types.NewChan(dirs[t.ChanDir()], p.typ(t.Elem()))
+	case reflect.Func:
+		return p.signature(t, nil, 0)
+	case reflect.Interface:
+		methods := make([]*types.Func, 0, t.NumMethod())
+		for i := 0; i < t.NumMethod(); i++ {
+			method := t.Method(i)
+			methods = append(methods, types.NewFunc(token.NoPos, p.methodPkg(t, method.PkgPath), method.Name, p.signature(method.Type, nil, 0)))
+		}
+		return types.NewInterfaceType(methods, nil).Complete()
+	case reflect.Struct:
+		fields := make([]*types.Var, 0, t.NumField())
+		tags := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fields = append(fields, types.NewField(token.NoPos, p.methodPkg(t, field.PkgPath), field.Name, p.typ(field.Type), field.Anonymous))
+			tags = append(tags, string(field.Tag))
+		}
+		return types.NewStruct(fields, tags)
+	}
+
+	return types.Typ[types.Invalid]
+}
+
+// methodPkg returns the package of a method or field, the package of unexported names
+// or the package declaring t.
+func (p *symbolImporter) methodPkg(t reflect.Type, pkgPath string) *types.Package {
+	if pkgPath == "" {
+		pkgPath = t.PkgPath()
+	}
+	if pkgPath == "" {
+		return nil
+	}
+
+	return p.pkg(pkgPath)
+}
+
+// signature returns the go/types signature of the func type t without its first skip parameters.
+func (p *symbolImporter) signature(t reflect.Type, recv *types.Var, skip int) *types.Signature {
+	params := make([]*types.Var, 0, t.NumIn())
+	for i := skip; i < t.NumIn(); i++ {
+		params = append(params, types.NewParam(token.NoPos, nil, "", p.typ(t.In(i))))
+	}
+
+	results := make([]*types.Var, 0, t.NumOut())
+	for i := 0; i < t.NumOut(); i++ {
+		results = append(results, types.NewParam(token.NoPos, nil, "", p.typ(t.Out(i))))
+	}
+
+	return types.NewSignatureType(recv, nil, nil, types.NewTuple(params...), types.NewTuple(results...), t.IsVariadic())
+}
@@ -0,0 +1,209 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/logging"
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// instance runs a single script with its own interpreter, error handler and watchdog.
+type instance struct {
+	name     string
+	path     string
+	lib      fs.FS
+	config   *config.Config
+	logger   *logrus.Logger
+	handler  *errorHandler
+	watchdog *watchdog
+	mqtt     *mqttRouter
+	events   chan event
+}
+
+// newInstance creates the runner of the script at path and registers its status.
+func newInstance(name string, path string, lib fs.FS, config *config.Config, mqtt *mqttRouter) *instance {
+	logger := logging.Prefixed(fmt.Sprintf("[%s] ", name))
+	handler := newErrorHandler(logger, config, name, path)
+
+	return &instance{
+		name:    name,
+		path:    path,
+		lib:     lib,
+		config:  config,
+		logger:  logger,
+		handler: handler,
+		mqtt:    mqtt,
+		events:  make(chan event, eventBuffer),
+		watchdog: newWatchdog(
+			logger,
+			handler,
+			time.Second*time.Duration(config.Script.Timeout),
+			time.Second*time.Duration(config.Script.Watchdog),
+		),
+	}
+}
+
+// load evaluates the script file into a new ScriptRunner connected to the mqtt router.
+func (p *instance) load() (*ScriptRunner, error) {
+	runner, err := loadScript(p.name, p.path, p.lib, p.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	runner.mqtt.inst, runner.mqtt.router = p, p.mqtt
+	return runner, nil
+}
+
+// Start evaluates the script and runs it until ctx is done.
+func (p *instance) Start(ctx context.Context, eg *errgroup.Group) error {
+	runner, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	var reloads <-chan *ScriptRunner
+	if p.config.Script.Reload {
+		if reloads, err = WatchScript(ctx, p.logger, p.path, runner.content, p.load, eg); err != nil {
+			return err
+		}
+	}
+
+	eg.Go(func() error {
+		return p.watchdog.Watch(ctx)
+	})
+
+	eg.Go(func() error {
+		return p.run(ctx, runner, reloads)
+	})
+
+	return nil
+}
+
+// post queues an event, it is dropped if the queue of the script is full.
+func (p *instance) post(ev event) {
+	select {
+	case p.events <- ev:
+	default:
+		metrics.Dropped.WithLabelValues("script_" + p.name).Inc()
+		p.logger.Warnf("script-runner: event queue full, %s dropped", ev.entrypoint)
+	}
+}
+
+// activate records the settings of the loaded script.
+func (p *instance) activate(runner *ScriptRunner) {
+	p.handler.setScript(runner.enabled, runner.interval)
+	p.mqtt.Set(p, runner.mqttTopics)
+}
+
+// run calls Setup once, Script at the run interval and the event entrypoints when events occur.
+//
+// All entrypoints are called by this goroutine, so the interpreter is never used concurrently.
+// Changed scripts are swapped in between two calls.
+func (p *instance) run(ctx context.Context, runner *ScriptRunner, reloads <-chan *ScriptRunner) error {
+	p.activate(runner)
+	if !runner.enabled {
+		p.logger.Info("script-runner: script is disabled")
+	}
+
+	setup := true
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("script-runner: done received -> closing")
+			p.shutdown(runner, setup)
+			return nil
+		case ev := <-p.events:
+			// a disabled or suspended script doesn't receive events
+			if setup || !runner.enabled || p.handler.SafeMode() {
+				continue
+			}
+
+			var call func(ctx context.Context) error
+			switch {
+			case ev.handler != nil:
+				// messages queued for the handlers of a replaced script are dropped
+				if ev.client != runner.mqtt {
+					continue
+				}
+				call = func(ctx context.Context) error {
+					return runner.CallHandler(ctx, ev.handler, ev.args[0].(string), ev.args[1].([]byte))
+				}
+			case runner.HasEntrypoint(ev.entrypoint):
+				call = func(ctx context.Context) error {
+					return runner.CallEntrypoint(ctx, ev.entrypoint, ev.snapshot, ev.args...)
+				}
+			default:
+				continue
+			}
+
+			err := p.watchdog.Run(ctx, ev.entrypoint, call)
+			if _, err := p.handler.Done(err); err != nil {
+				return err
+			}
+		case next := <-reloads:
+			if !next.enabled {
+				runner.mqtt.release()
+				runner, setup = next, true
+				p.activate(next)
+				p.handler.Reset()
+				p.logger.Info("script-runner: changed script is disabled")
+				continue
+			}
+
+			// the changed script is set up between two runs, so both never run at the same time
+			if err := p.watchdog.Run(ctx, "setup", next.CallSetup); err != nil {
+				p.logger.Errorf("script-runner: keep running script, setup of changed script failed: %v", err)
+				next.mqtt.release()
+				continue
+			}
+
+			runner.mqtt.release()
+			runner, setup = next, false
+			p.activate(next)
+			p.handler.Reset()
+			p.logger.Info("script-runner: changed script loaded")
+		case <-timer.C:
+			// a disabled or suspended script is neither run nor counted
+			wait := p.handler.Interval()
+			if runner.enabled && !p.handler.SafeMode() {
+				var err error
+				if setup {
+					if err = p.watchdog.Run(ctx, "setup", runner.CallSetup); err == nil {
+						setup = false
+					}
+				} else {
+					err = p.watchdog.Run(ctx, "script", runner.CallScript)
+				}
+
+				if wait, err = p.handler.Done(err); err != nil {
+					return err
+				}
+			}
+
+			timer.Reset(wait)
+		}
+	}
+}
+
+// shutdown calls OnShutdown of a running script with a new context, the service context is done already.
+func (p *instance) shutdown(runner *ScriptRunner, setup bool) {
+	if setup || !runner.enabled || !runner.HasEntrypoint(EntrypointOnShutdown) {
+		return
+	}
+
+	err := p.watchdog.Run(context.Background(), EntrypointOnShutdown, func(ctx context.Context) error {
+		return runner.CallEntrypoint(ctx, EntrypointOnShutdown, runner.scriptContext.SensorStore.Snapshot())
+	})
+	if err != nil {
+		p.logger.Errorf("script-runner: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package script
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// srcDir is the directory below the GOPATH of the interpreter holding the source packages.
+const srcDir = "src"
+
+var (
+	libraryMutex sync.RWMutex
+	library      fs.FS
+)
+
+// SetLibrary sets helper packages importable by the scripts, e.g. an embed.FS compiled into the binary.
+// A package is imported by its path relative to the root of fsys. A directory given by -script-lib takes precedence.
+func SetLibrary(fsys fs.FS) {
+	libraryMutex.Lock()
+	defer libraryMutex.Unlock()
+	library = fsys
+}
+
+// LoadLibrary returns the helper packages importable by the scripts.
+//
+// These are the packages in dir if it is set, the library set by SetLibrary or $GOPATH/src.
+// Without any of them, scripts can only import the packages exported by the symbols package.
+//
+// Parameters:
+// - dir: the directory of the helper packages, may be empty.
+//
+// Returns:
+// - fs.FS: the helper packages, nil if there are none.
+// - error: an error if dir is not a directory.
+func LoadLibrary(dir string) (fs.FS, error) {
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "script library")
+		}
+		if !info.IsDir() {
+			return nil, errors.Errorf("script library %s is not a directory", dir)
+		}
+
+		return os.DirFS(dir), nil
+	}
+
+	libraryMutex.RLock()
+	defer libraryMutex.RUnlock()
+	if library != nil {
+		return library, nil
+	}
+
+	if gopath, ok := os.LookupEnv("GOPATH"); ok && gopath != "" {
+		return os.DirFS(filepath.Join(gopath, srcDir)), nil
+	}
+
+	return nil, nil
+}
+
+// libraryFS presents the helper packages as src directory of the interpreter's GOPATH.
+// Without helper packages every import of a source package fails.
+type libraryFS struct {
+	lib fs.FS
+}
+
+// Open opens src/name as name of the helper packages.
+func (p libraryFS) Open(name string) (fs.File, error) {
+	if p.lib == nil || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if name == srcDir {
+		return p.lib.Open(".")
+	}
+
+	rel, ok := strings.CutPrefix(name, srcDir+"/")
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return p.lib.Open(path.Clean(rel))
+}
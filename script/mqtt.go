@@ -0,0 +1,62 @@
+package script
+
+import (
+	"time"
+
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+// errMqttDisabled is returned by the mqtt client of a script if the service has no mqtt connection.
+var errMqttDisabled = errors.New("mqtt is disabled")
+
+// mqttClient is the types.MqttClient of a loaded script, it shares the connection of the router.
+// The subscriptions belong to the loaded script and are released when it is replaced.
+type mqttClient struct {
+	inst   *instance
+	router *mqttRouter
+}
+
+// Publish publishes payload to topic.
+func (p *mqttClient) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	if !p.router.enabled() {
+		return errMqttDisabled
+	}
+
+	return errors.Wrapf(p.router.connection.Publish(topic, qos, retained, payload), "publish %s", topic)
+}
+
+// Subscribe calls handler for each message on the topic filter.
+func (p *mqttClient) Subscribe(topic string, handler types.MqttHandler) error {
+	if !p.router.enabled() {
+		return errMqttDisabled
+	}
+	if handler == nil {
+		return errors.Errorf("subscribe %s: handler is nil", topic)
+	}
+
+	return p.router.subscribe(p, topic, handler)
+}
+
+// Unsubscribe removes the handler of the topic filter.
+func (p *mqttClient) Unsubscribe(topic string) error {
+	if !p.router.enabled() {
+		return errMqttDisabled
+	}
+
+	return p.router.unsubscribe(p, topic)
+}
+
+// Retained returns the retained message of topic, waiting up to timeout for the broker to send it.
+func (p *mqttClient) Retained(topic string, timeout time.Duration) ([]byte, bool, error) {
+	if !p.router.enabled() {
+		return nil, false, errMqttDisabled
+	}
+
+	return p.router.retained(topic, timeout)
+}
+
+// release removes the subscriptions of the client.
+func (p *mqttClient) release() {
+	p.router.release(p)
+}
@@ -0,0 +1,236 @@
+package script
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ErrorPolicyContinue logs the error and runs the script at the next interval.
+	ErrorPolicyContinue = "continue"
+	// ErrorPolicyBackoff doubles the delay to the next run with each consecutive error.
+	ErrorPolicyBackoff = "backoff"
+	// ErrorPolicyFail stops the service after MaxErrors consecutive errors.
+	ErrorPolicyFail = "fail"
+	// ErrorPolicySafeMode switches the actuators of the script off after MaxErrors consecutive errors
+	// and suspends the script until a changed script is loaded.
+	ErrorPolicySafeMode = "safe-mode"
+)
+
+// Status describes the health of a script.
+type Status struct {
+	Name              string     `json:"name"`
+	Path              string     `json:"path"`
+	Enabled           bool       `json:"enabled"`
+	Interval          string     `json:"interval"`
+	Policy            string     `json:"policy"`
+	Runs              uint64     `json:"runs"`
+	Errors            uint64     `json:"errors"`
+	ConsecutiveErrors int        `json:"consecutive_errors"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastErrorTime     *time.Time `json:"last_error_time,omitempty"`
+	SafeMode          bool       `json:"safe_mode"`
+	Overruns          uint64     `json:"overruns"`
+	Stalled           bool       `json:"stalled"`
+}
+
+// errorHandler applies the configured error policy to the results of script and setup runs.
+type errorHandler struct {
+	logger          *logrus.Logger
+	name            string
+	defaultInterval time.Duration
+	maxErrors       int
+	maxBackoff      time.Duration
+
+	mutex    sync.Mutex
+	interval time.Duration
+	status   Status
+}
+
+var (
+	handlersMutex sync.Mutex
+	handlers      []*errorHandler
+)
+
+// GetStatus returns the status of all scripts ordered by name.
+func GetStatus() []Status {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+
+	status := make([]Status, 0, len(handlers))
+	for _, handler := range handlers {
+		handler.mutex.Lock()
+		status = append(status, handler.status)
+		handler.mutex.Unlock()
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+
+	return status
+}
+
+// validatePolicy validates the error policy of config.
+func validatePolicy(config *config.Config) error {
+	switch config.Script.ErrorPolicy {
+	case ErrorPolicyContinue, ErrorPolicyBackoff, ErrorPolicyFail, ErrorPolicySafeMode:
+	default:
+		return errors.Errorf("unknown script error policy %q", config.Script.ErrorPolicy)
+	}
+
+	if config.Script.MaxErrors < 1 {
+		return errors.New("script max errors must be at least 1")
+	}
+
+	return nil
+}
+
+// newErrorHandler returns a handler applying the error policy of config to the script name
+// and registers its status.
+func newErrorHandler(logger *logrus.Logger, config *config.Config, name string, path string) *errorHandler {
+	interval := time.Second * time.Duration(config.Script.RunInterval)
+
+	handler := &errorHandler{
+		logger:          logger,
+		name:            name,
+		defaultInterval: interval,
+		maxErrors:       config.Script.MaxErrors,
+		maxBackoff:      time.Second * time.Duration(config.Script.MaxBackoff),
+		interval:        interval,
+		status: Status{
+			Name:     name,
+			Path:     path,
+			Interval: interval.String(),
+			Policy:   config.Script.ErrorPolicy,
+		},
+	}
+
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers = append(handlers, handler)
+
+	return handler
+}
+
+// setScript records whether the loaded script is enabled and its run interval,
+// 0 selects the configured interval.
+func (p *errorHandler) setScript(enabled bool, interval time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if interval <= 0 {
+		interval = p.defaultInterval
+	}
+
+	p.interval = interval
+	p.status.Enabled = enabled
+	p.status.Interval = interval.String()
+}
+
+// Interval returns the run interval of the script.
+func (p *errorHandler) Interval() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.interval
+}
+
+// SafeMode reports whether the script is suspended.
+func (p *errorHandler) SafeMode() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.status.SafeMode
+}
+
+// Done records the result of a script or setup run and returns the delay to the next run.
+//
+// An error is returned if the service has to stop.
+func (p *errorHandler) Done(err error) (time.Duration, error) {
+	if err == nil {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		p.status.Runs++
+		p.status.ConsecutiveErrors = 0
+		return p.interval, nil
+	}
+
+	return p.failure(err)
+}
+
+// failure records a failed run and applies the error policy.
+func (p *errorHandler) failure(err error) (time.Duration, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	p.status.Runs++
+	p.status.Errors++
+	p.status.ConsecutiveErrors++
+	p.status.LastError = err.Error()
+	p.status.LastErrorTime = &now
+	metrics.ScriptErrors.WithLabelValues(p.name).Inc()
+
+	p.logger.Errorf("script-runner: %v (%d consecutive errors)", err, p.status.ConsecutiveErrors)
+
+	switch p.status.Policy {
+	case ErrorPolicyBackoff:
+		wait := p.interval
+		for i := 1; i < p.status.ConsecutiveErrors && wait < p.maxBackoff; i++ {
+			wait *= 2
+		}
+		if wait > p.maxBackoff {
+			wait = p.maxBackoff
+		}
+		return wait, nil
+	case ErrorPolicyFail:
+		if p.status.ConsecutiveErrors >= p.maxErrors {
+			return 0, errors.Wrapf(err, "script %s: %d consecutive errors", p.name, p.status.ConsecutiveErrors)
+		}
+	case ErrorPolicySafeMode:
+		if p.status.ConsecutiveErrors >= p.maxErrors && !p.status.SafeMode {
+			p.status.SafeMode = true
+			p.logger.Errorf("script-runner: entering safe mode, the actuators of the script are switched off until it is changed")
+			if err := types.Actuators().SafeState(p.name); err != nil {
+				p.logger.Errorf("script-runner: %v", err)
+			}
+		}
+	}
+
+	return p.interval, nil
+}
+
+// Reset is called when a changed script is loaded, it leaves safe mode
+// and hands the actuators of the script back to their timers.
+func (p *errorHandler) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.status.ConsecutiveErrors = 0
+	if p.status.SafeMode {
+		p.status.SafeMode = false
+		p.logger.Info("script-runner: leaving safe mode")
+		types.Actuators().Resume(p.name)
+	}
+}
+
+// overrun records a run exceeding its timeout.
+func (p *errorHandler) overrun() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.Overruns++
+}
+
+// setStalled records whether the watchdog detected a stalled run.
+func (p *errorHandler) setStalled(stalled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.Stalled = stalled
+}
@@ -0,0 +1,418 @@
+package script
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/symbols"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+	"golang.org/x/sync/errgroup"
+)
+
+// interpreterPos matches the line:column prefix of the errors of the interpreter.
+var interpreterPos = regexp.MustCompile(`^(\d+):(\d+): (.*)$`)
+
+// replPackage is the package holding the ScriptContext of a repl session.
+const replPackage = "repl/repl"
+
+// replPreload imports the packages used most in a session and declares ctx.
+const replPreload = `
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/host/v3/rpi"
+	"repl"
+)
+
+var ctx = repl.Context
+`
+
+// errReplReadOnly is returned by the actuators, pins, stores and mqtt publishes of a read-only repl session.
+var errReplReadOnly = errors.New("read-only repl session, reconnect with sensor repl -actuators")
+
+// ReplHello is sent by the client as first line of a repl session.
+type ReplHello struct {
+	// Actuators asks for a session which can switch actuators, publish mqtt messages and write to the stores.
+	Actuators bool `json:"actuators"`
+}
+
+// replServer accepts repl sessions on a unix socket.
+type replServer struct {
+	logger *logrus.Logger
+	config *config.Config
+	lib    fs.FS
+	mqtt   *mqttRouter
+
+	mutex    sync.Mutex
+	sessions map[net.Conn]bool
+}
+
+// serveRepl listens for repl sessions on the unix socket until ctx is done.
+//
+// Only the owner of the service can connect, the socket is created with mode 0600.
+// Sessions are read-only unless the client asks for actuator commands and
+// config.Repl.Actuators allows them.
+func serveRepl(ctx context.Context, logger *logrus.Logger, config *config.Config, lib fs.FS, mqtt *mqttRouter, eg *errgroup.Group) error {
+	path := config.Repl.Socket
+
+	// a socket left over by a previous run blocks the listener, a running service keeps its socket
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return errors.Errorf("repl socket %s is used by a running service", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return errors.Wrap(err, "remove stale repl socket")
+		}
+	}
+
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return errors.Wrap(err, "listen on repl socket")
+	}
+
+	server := &replServer{
+		logger:   logger,
+		config:   config,
+		lib:      lib,
+		mqtt:     mqtt,
+		sessions: make(map[net.Conn]bool),
+	}
+
+	logger.Infof("repl: listening on %s", path)
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		logger.Info("repl: done received -> closing")
+		listener.Close()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("repl: remove socket: %v", err)
+		}
+		server.closeSessions()
+		return nil
+	})
+
+	eg.Go(func() error {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.Wrap(err, "accept repl session")
+			}
+
+			go server.serve(ctx, conn)
+		}
+	})
+
+	return nil
+}
+
+// listenPrivate listens on a unix socket at path with mode 0600.
+//
+// The socket is created in a private directory next to path and moved to path once its mode is set,
+// so others can't connect in between. The process umask is left alone, it applies to all goroutines.
+func listenPrivate(path string) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".repl-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create socket directory")
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is moved, it is removed at path by the caller
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "set socket mode")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "move socket")
+	}
+
+	return listener, nil
+}
+
+// closeSessions closes the connections of all sessions, which ends their evaluations.
+func (p *replServer) closeSessions() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for conn := range p.sessions {
+		conn.Close()
+	}
+}
+
+// serve runs a repl session on conn.
+func (p *replServer) serve(ctx context.Context, conn net.Conn) {
+	p.mutex.Lock()
+	p.sessions[conn] = true
+	p.mutex.Unlock()
+
+	defer func() {
+		p.mutex.Lock()
+		delete(p.sessions, conn)
+		p.mutex.Unlock()
+		conn.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	var hello ReplHello
+	if err := json.Unmarshal(line, &hello); err != nil {
+		fmt.Fprintf(conn, "error: invalid repl hello: %v\n", err)
+		return
+	}
+
+	if hello.Actuators && !p.config.Repl.Actuators {
+		fmt.Fprintln(conn, "error: actuator commands are disabled, start the service with -repl-actuators")
+		return
+	}
+
+	mode := "read-only"
+	if hello.Actuators {
+		mode = "actuators enabled"
+	}
+	p.logger.Infof("repl: session opened (%s)", mode)
+	defer p.logger.Info("repl: session closed")
+
+	session, err := newReplSession(ctx, conn, p.lib, p.mqtt, hello.Actuators)
+	if err != nil {
+		fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(conn, "sensor repl (%s), ctx is the ScriptContext of the session, ctx.Snapshot is taken before each input\n", mode)
+	session.run(ctx, reader, time.Second*time.Duration(p.config.Script.Timeout))
+}
+
+// replSession is the interpreter of a repl session.
+type replSession struct {
+	i      *interp.Interpreter
+	out    io.Writer
+	script *types.ScriptContext
+}
+
+// newReplSession creates the interpreter of a session writing its output to out.
+func newReplSession(ctx context.Context, out io.Writer, lib fs.FS, mqtt *mqttRouter, actuators bool) (*replSession, error) {
+	i := interp.New(interp.Options{
+		GoPath:               ".",
+		SourcecodeFilesystem: libraryFS{lib: lib},
+		Stdout:               out,
+		Stderr:               out,
+	})
+
+	logger := logrus.New()
+	logger.SetOutput(out)
+
+	scriptContext := &types.ScriptContext{
+		Name:          "repl",
+		Logger:        logger,
+		SensorStore:   store.Sensor(),
+		EmbeddedStore: store.Embedded(),
+		Context:       ctx,
+		Mqtt:          &replMqtt{router: mqtt, actuators: actuators},
+	}
+
+	exports := []interp.Exports{stdlib.Symbols, symbols.Symbols}
+	if !actuators {
+		scriptContext.SensorStore = readOnlySensorStore{SensorStore: scriptContext.SensorStore}
+		scriptContext.EmbeddedStore = readOnlyEmbeddedStore{EmbeddedStore: scriptContext.EmbeddedStore}
+		exports = append(exports, readOnlyExports(scriptContext))
+	}
+
+	exports = append(exports, interp.Exports{
+		replPackage: {
+			"Context": reflect.ValueOf(scriptContext),
+			"Print":   reflect.ValueOf(replPrint(out)),
+		},
+	})
+
+	for _, values := range exports {
+		if err := i.Use(values); err != nil {
+			return nil, errors.Wrap(err, "load symbols")
+		}
+	}
+
+	// other packages are imported with an import statement in the session
+	if _, err := i.Eval(replPreload); err != nil {
+		return nil, errors.Wrap(err, "preload ScriptContext")
+	}
+
+	return &replSession{i: i, out: out, script: scriptContext}, nil
+}
+
+// run evaluates the input line by line until the client disconnects.
+// Incomplete statements are continued on the next line, timeout limits each evaluation.
+func (p *replSession) run(ctx context.Context, in io.Reader, timeout time.Duration) {
+	lines := bufio.NewScanner(in)
+	src := ""
+
+	fmt.Fprint(p.out, "> ")
+	for lines.Scan() {
+		line := lines.Text()
+		src += line + "\n"
+
+		// the values of an expression are printed, calls without result are evaluated as they are
+		if _, err := parser.ParseExpr(src); err == nil {
+			if print := "repl.Print(" + strings.TrimSpace(src) + ")"; p.compiles(print) {
+				src = print
+			}
+		}
+
+		p.script.Snapshot = p.script.SensorStore.Snapshot()
+		if _, err := p.eval(ctx, src, timeout); err != nil {
+			var list scanner.ErrorList
+			if errors.As(err, &list) && len(list) > 0 && replIncomplete(list[0], line) {
+				fmt.Fprint(p.out, "… ")
+				continue
+			}
+
+			fmt.Fprintln(p.out, replError(err))
+		}
+
+		src = ""
+		fmt.Fprint(p.out, "> ")
+	}
+}
+
+// eval evaluates src with the session context, limited to timeout if it is set.
+func (p *replSession) eval(ctx context.Context, src string, timeout time.Duration) (reflect.Value, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return p.i.EvalWithContext(ctx, src)
+}
+
+// replIncomplete reports whether the parse error means the statement continues on the next line.
+func replIncomplete(err *scanner.Error, line string) bool {
+	switch {
+	case strings.HasSuffix(err.Msg, "found 'EOF'"):
+		return true
+	case err.Msg == "raw string literal not terminated":
+		return true
+	case strings.HasPrefix(err.Msg, "expected operand, found '}'") && !strings.HasSuffix(line, "}"):
+		return true
+	}
+
+	return false
+}
+
+// compiles reports whether src compiles, it isn't run.
+func (p *replSession) compiles(src string) bool {
+	_, err := p.i.Compile(src)
+	return err == nil
+}
+
+// replPrint returns the function printing the values of an expression to out.
+func replPrint(out io.Writer) func(values ...interface{}) {
+	return func(values ...interface{}) {
+		list := make([]string, 0, len(values))
+		for _, value := range values {
+			list = append(list, fmt.Sprintf("%v", value))
+		}
+
+		fmt.Fprintln(out, ":", strings.Join(list, ", "))
+	}
+}
+
+// replError formats an evaluation error without the name of the interpreter's source.
+func replError(err error) string {
+	var p interp.Panic
+	if errors.As(err, &p) {
+		return fmt.Sprintf("panic: %v", p.Value)
+	}
+
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		return strings.TrimPrefix(list[0].Error(), interp.DefaultSourceName+":")
+	}
+
+	// positions refer to the input wrapped by the interpreter, they don't help
+	if match := interpreterPos.FindStringSubmatch(err.Error()); match != nil {
+		return match[3]
+	}
+
+	return err.Error()
+}
+
+// replMqtt is the mqtt client of a repl session. Sessions can't subscribe,
+// their handlers would need a script runner calling them.
+type replMqtt struct {
+	router    *mqttRouter
+	actuators bool
+}
+
+// Publish publishes payload to topic if the session allows actuator commands.
+func (p *replMqtt) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	if !p.actuators {
+		return errReplReadOnly
+	}
+	if !p.router.enabled() {
+		return errMqttDisabled
+	}
+
+	return errors.Wrapf(p.router.connection.Publish(topic, qos, retained, payload), "publish %s", topic)
+}
+
+// Subscribe isn't supported in a repl session.
+func (p *replMqtt) Subscribe(topic string, handler types.MqttHandler) error {
+	return errors.New("subscriptions are not supported in the repl, use Retained")
+}
+
+// Unsubscribe isn't supported in a repl session.
+func (p *replMqtt) Unsubscribe(topic string) error {
+	return errors.New("subscriptions are not supported in the repl")
+}
+
+// Retained returns the retained message of topic, waiting up to timeout for the broker to send it.
+func (p *replMqtt) Retained(topic string, timeout time.Duration) ([]byte, bool, error) {
+	if !p.router.enabled() {
+		return nil, false, errMqttDisabled
+	}
+
+	return p.router.retained(topic, timeout)
+}
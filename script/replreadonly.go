@@ -0,0 +1,181 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/symbols"
+	"github.com/denkhaus/sensor/types"
+	"github.com/sirupsen/logrus"
+	"github.com/timshannon/badgerhold/v4"
+	"github.com/traefik/yaegi/interp"
+	"golang.org/x/sync/errgroup"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+)
+
+const (
+	rpiPackage   = "periph.io/x/host/v3/rpi/rpi"
+	typesPackage = "github.com/denkhaus/sensor/types/types"
+	storePackage = "github.com/denkhaus/sensor/store/store"
+)
+
+// readOnlyExports replaces the symbols of a read-only repl session which switch pins or write to the stores.
+// The pins of the rpi package can only be read and types.Actuators returns the state of the actuators.
+// The store functions registering metrics, setting values or writing the history fail.
+func readOnlyExports(scriptContext *types.ScriptContext) interp.Exports {
+	pinType := reflect.TypeOf((*gpio.PinIO)(nil)).Elem()
+	pins := make(map[string]reflect.Value)
+
+	for name, value := range symbols.Symbols[rpiPackage] {
+		if value.Type() != pinType || value.IsNil() {
+			continue
+		}
+
+		pin := reflect.New(pinType).Elem()
+		pin.Set(reflect.ValueOf(gpio.PinIO(readOnlyPin{PinIO: value.Interface().(gpio.PinIO)})))
+		pins[name] = pin
+	}
+
+	return interp.Exports{
+		rpiPackage: pins,
+		typesPackage: {
+			"Actuators": reflect.ValueOf(func() replActuators { return replActuators{} }),
+		},
+		storePackage: {
+			"Sensor":   reflect.ValueOf(func() store.SensorStore { return scriptContext.SensorStore }),
+			"Embedded": reflect.ValueOf(func() store.EmbeddedStore { return scriptContext.EmbeddedStore }),
+			"Registry": reflect.ValueOf(func() store.MetricRegistry { return readOnlyRegistry{MetricRegistry: store.Registry()} }),
+			"Set":      reflect.ValueOf(func(id store.DataID, data float64) { panic(errReplReadOnly) }),
+			"Update":   reflect.ValueOf(func(fn func(batch store.Batch)) { panic(errReplReadOnly) }),
+
+			"RegisterMetric": reflect.ValueOf(func(metric store.Metric) error { return errReplReadOnly }),
+			"AppendHistory":  reflect.ValueOf(func(es store.EmbeddedStore, snapshot store.Snapshot) error { return errReplReadOnly }),
+			"PruneHistory":   reflect.ValueOf(func(es store.EmbeddedStore, before time.Time) error { return errReplReadOnly }),
+			"Initialize": reflect.ValueOf(func(ctx context.Context, logger *logrus.Logger, config *config.Config, eg *errgroup.Group) (store.EmbeddedStore, error) {
+				return nil, errReplReadOnly
+			}),
+		},
+	}
+}
+
+// readOnlyPin is a pin of a read-only repl session, its level can be read but not set.
+type readOnlyPin struct {
+	gpio.PinIO
+}
+
+// In fails, it would change the direction of the pin.
+func (p readOnlyPin) In(pull gpio.Pull, edge gpio.Edge) error {
+	return errReplReadOnly
+}
+
+// Out fails.
+func (p readOnlyPin) Out(l gpio.Level) error {
+	return errReplReadOnly
+}
+
+// PWM fails.
+func (p readOnlyPin) PWM(duty gpio.Duty, f physic.Frequency) error {
+	return errReplReadOnly
+}
+
+// replActuators is the actuator registry of a read-only repl session.
+type replActuators struct{}
+
+// Get returns the state of the actuator with the given name.
+func (replActuators) Get(name string) (replActuator, bool) {
+	act, ok := types.Actuators().Get(name)
+	return replActuator{act: act}, ok
+}
+
+// List returns the state of all actuators ordered by name.
+func (replActuators) List() []replActuator {
+	list := []replActuator{}
+	for _, act := range types.Actuators().List() {
+		list = append(list, replActuator{act: act})
+	}
+
+	return list
+}
+
+// replActuator exposes the state of an actuator to a read-only repl session.
+type replActuator struct {
+	act *types.Actuator
+}
+
+// The accessors read the state of the actuator like the methods of types.Actuator.
+
+func (p replActuator) Name() string             { return p.act.Name }
+func (p replActuator) Kind() types.ActuatorKind { return p.act.Kind() }
+func (p replActuator) IsOn() bool               { return p.act.IsOn() }
+func (p replActuator) OnTime() time.Duration    { return p.act.OnTime() }
+func (p replActuator) Pulses() uint64           { return p.act.Pulses() }
+func (p replActuator) Owner() string            { return p.act.Owner() }
+func (p replActuator) Mode() types.ActuatorMode { return p.act.Mode() }
+
+// String describes the state of the actuator.
+func (p replActuator) String() string {
+	if p.act == nil {
+		return "<no actuator>"
+	}
+
+	state := "off"
+	if p.act.IsOn() {
+		state = "on"
+	}
+
+	return fmt.Sprintf("%s: %s, %s, on %s, %d pulses, owner %q",
+		p.act.Name, state, p.act.Mode(), p.act.OnTime().Round(time.Second), p.act.Pulses(), p.act.Owner())
+}
+
+// readOnlySensorStore is the sensor store of a read-only repl session. Setting values panics,
+// which the repl reports as error, because the methods can't return an error.
+type readOnlySensorStore struct {
+	store.SensorStore
+}
+
+// Set panics.
+func (p readOnlySensorStore) Set(id store.DataID, data float64) {
+	panic(errReplReadOnly)
+}
+
+// Update panics with errReplReadOnly.
+func (p readOnlySensorStore) Update(fn func(batch store.Batch)) {
+	panic(errReplReadOnly)
+}
+
+// SetStaleAfter panics.
+func (p readOnlySensorStore) SetStaleAfter(dur time.Duration) {
+	panic(errReplReadOnly)
+}
+
+// readOnlyRegistry is the metric registry of a read-only repl session.
+type readOnlyRegistry struct {
+	store.MetricRegistry
+}
+
+// Register fails.
+func (p readOnlyRegistry) Register(metric store.Metric) error {
+	return errReplReadOnly
+}
+
+// readOnlyEmbeddedStore is the embedded store of a read-only repl session.
+type readOnlyEmbeddedStore struct {
+	store.EmbeddedStore
+}
+
+// The methods writing to the store fail.
+
+func (p readOnlyEmbeddedStore) Open() error                    { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) Close() error                   { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) Insert(key string, v any) error { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) Update(key string, v any) error { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) Upsert(key string, v any) error { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) Delete(key string, v any) error { return errReplReadOnly }
+func (p readOnlyEmbeddedStore) DeleteMatching(dataType interface{}, query *badgerhold.Query) error {
+	return errReplReadOnly
+}
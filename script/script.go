@@ -2,13 +2,16 @@ package script
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/denkhaus/sensor/config"
-	"github.com/denkhaus/sensor/logging"
+	"github.com/denkhaus/sensor/metrics"
 	"github.com/denkhaus/sensor/store"
 	"github.com/denkhaus/sensor/symbols"
 	"github.com/denkhaus/sensor/types"
@@ -21,16 +24,68 @@ import (
 
 type EntrypointFunc func(ctx *types.ScriptContext) error
 
+// Optional event entrypoints of a script.
+const (
+	// EntrypointOnSensorData is called after each poll cycle with the snapshot of all metrics.
+	EntrypointOnSensorData = "OnSensorData"
+	// EntrypointOnMqttMessage is called for each message on the topics listed in MqttTopics.
+	EntrypointOnMqttMessage = "OnMqttMessage"
+	// EntrypointOnTimer is called when a timer of the script switches or fires.
+	EntrypointOnTimer = "OnTimer"
+	// EntrypointOnShutdown is called when the service stops.
+	EntrypointOnShutdown = "OnShutdown"
+)
+
+// entrypointType is the signature of the Setup and Script entrypoints.
+var entrypointType = reflect.TypeOf((func(*types.ScriptContext) error)(nil))
+
+// entrypointTypes are the signatures of the optional entrypoints.
+var entrypointTypes = map[string]reflect.Type{
+	EntrypointOnSensorData:  reflect.TypeOf((func(*types.ScriptContext, store.Snapshot) error)(nil)),
+	EntrypointOnMqttMessage: reflect.TypeOf((func(*types.ScriptContext, string, []byte) error)(nil)),
+	EntrypointOnTimer:       reflect.TypeOf((func(*types.ScriptContext, string) error)(nil)),
+	EntrypointOnShutdown:    entrypointType,
+}
+
 type ScriptRunner struct {
+	name          string
 	i             *interp.Interpreter
 	scriptFunc    reflect.Value
 	setupFunc     reflect.Value
 	scriptContext *types.ScriptContext
 	content       string
+	entrypoints   map[string]reflect.Value
+	// mqttTopics are the topics of OnMqttMessage
+	mqttTopics []string
+	// mqtt is the client of ScriptContext.Mqtt, it is disabled until the script is loaded by an instance
+	mqtt *mqttClient
+
+	// interval is the RunInterval of the script, 0 if it uses the configured interval
+	interval time.Duration
+	// enabled is false if the script sets Enabled to false
+	enabled bool
 }
 
-func NewScriptRunner(scriptContent string, gopath string) (*ScriptRunner, error) {
-	i := interp.New(interp.Options{GoPath: gopath})
+// NewScriptRunner evaluates a script into a new interpreter.
+//
+// Besides the Setup and Script entrypoints, a script may define RunInterval (time.Duration)
+// to override the configured run interval and Enabled (bool) to disable itself.
+// The optional event entrypoints OnSensorData, OnMqttMessage, OnTimer and OnShutdown
+// are called when the event occurs, OnMqttMessage receives the topics listed in MqttTopics ([]string).
+//
+// Parameters:
+// - name: the name of the script, used as ScriptContext.Name.
+// - scriptContent: the source of the script.
+// - lib: the helper packages importable by the script, may be nil (see LoadLibrary).
+// - logger: the logger of the script.
+// - overrides: symbols replacing those of the standard and buildin library, e.g. a simulated time.Now.
+//
+// Returns:
+// - *ScriptRunner: the runner of the evaluated script.
+// - error: an error if the script could not be evaluated or an entrypoint is missing.
+func NewScriptRunner(name string, scriptContent string, lib fs.FS, logger *logrus.Logger, overrides ...interp.Exports) (*ScriptRunner, error) {
+	// the interpreter looks up source packages in GOPATH/src, which is mapped to lib
+	i := interp.New(interp.Options{GoPath: ".", SourcecodeFilesystem: libraryFS{lib: lib}})
 
 	if err := i.Use(stdlib.Symbols); err != nil {
 		return nil, errors.Wrap(err, "load standard library")
@@ -38,6 +93,11 @@ func NewScriptRunner(scriptContent string, gopath string) (*ScriptRunner, error)
 	if err := i.Use(symbols.Symbols); err != nil {
 		return nil, errors.Wrap(err, "load buildin library")
 	}
+	for _, exports := range overrides {
+		if err := i.Use(exports); err != nil {
+			return nil, errors.Wrap(err, "load overrides")
+		}
+	}
 
 	_, err := i.Eval(scriptContent)
 	if err != nil {
@@ -48,102 +108,300 @@ func NewScriptRunner(scriptContent string, gopath string) (*ScriptRunner, error)
 	if err != nil {
 		return nil, errors.Wrap(err, "find script entrypoint")
 	}
+	if scriptFunc.Type() != entrypointType {
+		return nil, errors.Errorf("Script must be a %s", entrypointType)
+	}
 
 	setupFunc, err := i.Eval(`main.Setup`)
 	if err != nil {
 		return nil, errors.Wrap(err, "find setup entrypoint")
 	}
+	if setupFunc.Type() != entrypointType {
+		return nil, errors.Errorf("Setup must be a %s", entrypointType)
+	}
 
-	scriptContext := &types.ScriptContext{
-		Logger:        logging.Logger(),
-		SensorStore:   store.Sensor(),
-		EmbeddedStore: store.Embedded(),
+	mqtt := &mqttClient{}
+	runner := &ScriptRunner{
+		name:        name,
+		i:           i,
+		content:     scriptContent,
+		scriptFunc:  scriptFunc,
+		setupFunc:   setupFunc,
+		enabled:     true,
+		entrypoints: make(map[string]reflect.Value),
+		mqtt:        mqtt,
+		scriptContext: &types.ScriptContext{
+			Name:          name,
+			Logger:        logger,
+			SensorStore:   store.Sensor(),
+			EmbeddedStore: store.Embedded(),
+			Mqtt:          mqtt,
+		},
 	}
 
-	return &ScriptRunner{
-		i:             i,
-		content:       scriptContent,
-		scriptFunc:    scriptFunc,
-		setupFunc:     setupFunc,
-		scriptContext: scriptContext,
-	}, nil
-}
+	if value, ok := optionalVar(i, "RunInterval"); ok {
+		interval, ok := value.Interface().(time.Duration)
+		if !ok || interval <= 0 {
+			return nil, errors.Errorf("RunInterval must be a positive time.Duration")
+		}
+		runner.interval = interval
+	}
 
-func (s *ScriptRunner) CallScript() error {
-	in := []reflect.Value{
-		reflect.ValueOf(s.scriptContext),
+	if value, ok := optionalVar(i, "Enabled"); ok {
+		enabled, ok := value.Interface().(bool)
+		if !ok {
+			return nil, errors.Errorf("Enabled must be a bool")
+		}
+		runner.enabled = enabled
 	}
 
-	out := s.scriptFunc.Call(in)
-	if e := out[0].Interface(); e != nil {
-		err := e.(error)
-		return errors.Wrap(err, "execute script entrypoint")
+	for name, want := range entrypointTypes {
+		if value, ok := optionalVar(i, name); ok {
+			if value.Type() != want {
+				return nil, errors.Errorf("%s must be a %s", name, want)
+			}
+			runner.entrypoints[name] = value
+		}
 	}
 
-	return nil
+	if value, ok := optionalVar(i, "MqttTopics"); ok {
+		topics, ok := value.Interface().([]string)
+		if !ok {
+			return nil, errors.Errorf("MqttTopics must be a []string")
+		}
+		runner.mqttTopics = topics
+	}
+
+	if _, ok := runner.entrypoints[EntrypointOnMqttMessage]; !ok && len(runner.mqttTopics) > 0 {
+		return nil, errors.Errorf("MqttTopics requires an OnMqttMessage entrypoint")
+	}
+
+	return runner, nil
+}
+
+// optionalVar returns the package level variable or constant name of the script.
+func optionalVar(i *interp.Interpreter, name string) (reflect.Value, bool) {
+	value, err := i.Eval("main." + name)
+	if err != nil || !value.IsValid() {
+		return reflect.Value{}, false
+	}
+
+	return value, true
+}
+
+// recoverPanic converts a panic of the interpreted code into an error.
+func recoverPanic(name string, err *error) {
+	if r := recover(); r != nil {
+		*err = errors.Errorf("%s entrypoint panicked: %v", name, r)
+	}
 }
 
-func (s *ScriptRunner) CallSetup() error {
+// call runs the entrypoint fn with the ScriptContext and args. A panic is returned as error.
+func (s *ScriptRunner) call(ctx context.Context, name string, fn reflect.Value, snapshot store.Snapshot, args ...interface{}) (err error) {
+	defer recoverPanic(name, &err)
+
+	s.scriptContext.Context = ctx
+	s.scriptContext.Snapshot = snapshot
+
 	in := []reflect.Value{
 		reflect.ValueOf(s.scriptContext),
 	}
+	for _, arg := range args {
+		in = append(in, reflect.ValueOf(arg))
+	}
 
-	out := s.setupFunc.Call(in)
+	out := fn.Call(in)
 	if e := out[0].Interface(); e != nil {
-		err := e.(error)
-		return errors.Wrap(err, "execute setup entrypoint")
+		return errors.Wrapf(e.(error), "execute %s entrypoint", name)
 	}
 
 	return nil
 }
 
-func Initialize(ctx context.Context, logger *logrus.Logger, config *config.Config, eg *errgroup.Group) error {
-	absFilePath, err := filepath.Abs(config.Script.Path)
-	if err != nil {
-		return errors.Wrap(err, "get absolute path for input script")
+// CallScript runs the Script entrypoint with ctx as ScriptContext.Context. A panic is returned as error.
+func (s *ScriptRunner) CallScript(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		metrics.ScriptDuration.WithLabelValues(s.name).Observe(time.Since(start).Seconds())
+	}()
+
+	return s.call(ctx, "script", s.scriptFunc, s.scriptContext.SensorStore.Snapshot())
+}
+
+// CallSetup runs the Setup entrypoint with ctx as ScriptContext.Context. A panic is returned as error.
+func (s *ScriptRunner) CallSetup(ctx context.Context) error {
+	return s.call(ctx, "setup", s.setupFunc, s.scriptContext.SensorStore.Snapshot())
+}
+
+// Context returns the ScriptContext passed to the entrypoints.
+func (s *ScriptRunner) Context() *types.ScriptContext {
+	return s.scriptContext
+}
+
+// Interval returns the RunInterval of the script, 0 if it uses the configured interval.
+func (s *ScriptRunner) Interval() time.Duration {
+	return s.interval
+}
+
+// Enabled reports whether the script is enabled by its Enabled variable.
+func (s *ScriptRunner) Enabled() bool {
+	return s.enabled
+}
+
+// MqttTopics returns the topics of the OnMqttMessage entrypoint.
+func (s *ScriptRunner) MqttTopics() []string {
+	return s.mqttTopics
+}
+
+// HasEntrypoint reports whether the script defines the optional entrypoint name.
+func (s *ScriptRunner) HasEntrypoint(name string) bool {
+	_, ok := s.entrypoints[name]
+	return ok
+}
+
+// CallEntrypoint runs the optional entrypoint name with args, ScriptContext.Snapshot is set to snapshot.
+// Nothing is done if the script doesn't define the entrypoint.
+func (s *ScriptRunner) CallEntrypoint(ctx context.Context, name string, snapshot store.Snapshot, args ...interface{}) error {
+	fn, ok := s.entrypoints[name]
+	if !ok {
+		return nil
 	}
 
-	_, err = os.Stat(absFilePath)
+	return s.call(ctx, name, fn, snapshot, args...)
+}
+
+// CallHandler runs a mqtt handler subscribed by the script with the message of topic.
+func (s *ScriptRunner) CallHandler(ctx context.Context, handler types.MqttHandler, topic string, payload []byte) error {
+	return s.call(ctx, entrypointMqttHandler, reflect.ValueOf(handler), s.scriptContext.SensorStore.Snapshot(), topic, payload)
+}
+
+// loadScript reads the script at path and evaluates it into a new ScriptRunner.
+func loadScript(name string, path string, lib fs.FS, logger *logrus.Logger) (*ScriptRunner, error) {
+	contentBuf, err := os.ReadFile(path)
 	if err != nil {
-		return errors.New("no input script found")
+		return nil, errors.Wrap(err, "read input script")
 	}
 
-	contentBuf, err := os.ReadFile(absFilePath)
+	runner, err := NewScriptRunner(name, string(contentBuf), lib, logger)
 	if err != nil {
-		return errors.Wrap(err, "read input script")
+		return nil, errors.Wrap(err, "create script runner")
 	}
 
-	gopath, ok := os.LookupEnv("GOPATH")
-	if !ok {
-		return errors.New("can't lookup GOPATH")
-	}
+	return runner, nil
+}
 
-	runner, err := NewScriptRunner(string(contentBuf), gopath)
-	if err != nil {
-		return errors.Wrap(err, "create script runner")
+// scriptName returns the name of the script at path, the file name without extension.
+func scriptName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// resolveScripts returns the absolute paths of the given scripts.
+// All go files of a directory are added in lexical order.
+func resolveScripts(paths []string) ([]string, error) {
+	scripts := []string{}
+	names := make(map[string]string)
+
+	add := func(path string) error {
+		name := scriptName(path)
+		if other, ok := names[name]; ok {
+			return errors.Errorf("scripts %s and %s have the same name %s", other, path, name)
+		}
+
+		names[name] = path
+		scripts = append(scripts, path)
+		return nil
 	}
 
-	durRunInterval := time.Second * time.Duration(config.Script.RunInterval)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "get absolute path for input script")
+		}
 
-	eg.Go(func() error {
-		if err := runner.CallSetup(); err != nil {
-			return errors.Wrap(err, "CallSetup")
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return nil, errors.Errorf("no input script found at %s", path)
 		}
 
-		for {
-			if err := runner.CallScript(); err != nil {
-				return errors.Wrap(err, "CallScript")
+		if !info.IsDir() {
+			if err := add(absPath); err != nil {
+				return nil, err
 			}
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(absPath, "*.go"))
+		if err != nil {
+			return nil, errors.Wrap(err, "list scripts")
+		}
 
-			select {
-			case <-ctx.Done():
-				logger.Info("script-runner: done received -> closing")
-				return nil
-			default:
-				time.Sleep(durRunInterval)
+		sort.Strings(files)
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+			if err := add(file); err != nil {
+				return nil, err
 			}
 		}
-	})
+	}
+
+	if len(scripts) == 0 {
+		return nil, errors.New("no input script found")
+	}
+
+	return scripts, nil
+}
+
+// Initialize starts a runner for each configured script.
+//
+// Each script runs in its own interpreter and goroutine, so a failing script
+// doesn't affect the others. Scripts listed in config.Script.Disabled are not started.
+// The scripts share the mqtt connection, which may be nil if mqtt is disabled.
+// If config.Repl.Socket is set, repl sessions are served on the unix socket.
+func Initialize(ctx context.Context, logger *logrus.Logger, config *config.Config, mqtt MqttConnection, eg *errgroup.Group) error {
+	if err := validatePolicy(config); err != nil {
+		return err
+	}
+
+	paths, err := resolveScripts(config.Script.Path)
+	if err != nil {
+		return err
+	}
+
+	lib, err := LoadLibrary(config.Script.Lib)
+	if err != nil {
+		return err
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range config.Script.Disabled {
+		disabled[strings.TrimSpace(name)] = true
+	}
+
+	router := newMqttRouter(mqtt, byte(config.Mqtt.Qos.Commands))
+	types.OnTimer(notifyTimer)
+
+	if config.Repl.Socket != "" {
+		if err := serveRepl(ctx, logger, config, lib, router, eg); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		name := scriptName(path)
+		inst := newInstance(name, path, lib, config, router)
+
+		if disabled[name] {
+			logger.Infof("script-runner: script %s is disabled", name)
+			continue
+		}
+
+		running.add(inst)
+		if err := inst.Start(ctx, eg); err != nil {
+			return errors.Wrapf(err, "start script %s", name)
+		}
+	}
 
 	return nil
 }
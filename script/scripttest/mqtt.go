@@ -0,0 +1,129 @@
+package scripttest
+
+import (
+	"time"
+
+	"github.com/denkhaus/sensor/broker"
+	"github.com/denkhaus/sensor/clock"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+// maxDeliveries limits the handler calls following one entrypoint call,
+// a handler publishing to its own topic would run the simulation forever.
+const maxDeliveries = 1000
+
+// Publication is a message published by the script.
+type Publication struct {
+	Time     time.Time
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// delivery is a message for a handler subscribed by the script.
+type delivery struct {
+	handler types.MqttHandler
+	topic   string
+	payload []byte
+}
+
+// fakeMqtt is the mqtt client of the simulated script. Published messages are recorded
+// and delivered to the subscribed handlers after the entrypoint returns, like the broker would.
+type fakeMqtt struct {
+	clock    *clock.Fake
+	result   *Result
+	handlers map[string]types.MqttHandler
+	retained map[string][]byte
+	pending  []delivery
+	// delivered counts the handler calls since the last entrypoint call of the simulation
+	delivered int
+}
+
+func newFakeMqtt(fake *clock.Fake, result *Result, retained map[string]string) *fakeMqtt {
+	p := &fakeMqtt{
+		clock:    fake,
+		result:   result,
+		handlers: make(map[string]types.MqttHandler),
+		retained: make(map[string][]byte),
+	}
+
+	for topic, payload := range retained {
+		p.retained[topic] = []byte(payload)
+	}
+
+	return p
+}
+
+// Publish records the message and queues it for the matching handlers.
+func (p *fakeMqtt) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	p.result.Published = append(p.result.Published, Publication{
+		Time:     p.clock.Now(),
+		Topic:    topic,
+		Payload:  payload,
+		Retained: retained,
+	})
+
+	if retained {
+		if len(payload) == 0 {
+			delete(p.retained, topic)
+		} else {
+			p.retained[topic] = payload
+		}
+	}
+
+	p.deliver(topic, payload)
+	return nil
+}
+
+// Subscribe registers handler and queues the matching retained messages for it.
+func (p *fakeMqtt) Subscribe(topic string, handler types.MqttHandler) error {
+	p.handlers[topic] = handler
+
+	for retained, payload := range p.retained {
+		if broker.MatchTopic(topic, retained) {
+			p.pending = append(p.pending, delivery{handler: handler, topic: retained, payload: payload})
+		}
+	}
+
+	return nil
+}
+
+// Unsubscribe removes the handler of the topic filter.
+func (p *fakeMqtt) Unsubscribe(topic string) error {
+	delete(p.handlers, topic)
+	return nil
+}
+
+// Retained returns the retained message of the scenario or published by the script.
+func (p *fakeMqtt) Retained(topic string, timeout time.Duration) ([]byte, bool, error) {
+	payload, ok := p.retained[topic]
+	return payload, ok, nil
+}
+
+// deliver queues a message for the handlers subscribed to a matching topic filter.
+func (p *fakeMqtt) deliver(topic string, payload []byte) {
+	for filter, handler := range p.handlers {
+		if broker.MatchTopic(filter, topic) {
+			p.pending = append(p.pending, delivery{handler: handler, topic: topic, payload: payload})
+		}
+	}
+}
+
+// next returns the next queued message, false if there is none.
+// It fails if the handlers keep publishing messages to each other.
+func (p *fakeMqtt) next() (delivery, bool, error) {
+	if len(p.pending) == 0 {
+		return delivery{}, false, nil
+	}
+
+	if p.delivered >= maxDeliveries {
+		p.pending = nil
+		return delivery{}, false, errors.Errorf("more than %d mqtt messages delivered in a row, messages dropped", maxDeliveries)
+	}
+
+	next := p.pending[0]
+	p.pending = p.pending[1:]
+	p.delivered++
+	return next, true, nil
+}
@@ -0,0 +1,132 @@
+package scripttest
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/denkhaus/sensor/clock"
+	"github.com/denkhaus/sensor/symbols"
+	"github.com/traefik/yaegi/interp"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+)
+
+// rpiPackage is the symbol path of the raspberry pi pins used by scripts.
+const rpiPackage = "periph.io/x/host/v3/rpi/rpi"
+
+// Change is a level change of a Pin at a simulated time.
+type Change struct {
+	Time  time.Time
+	Level gpio.Level
+}
+
+// Pin is a fake gpio pin recording its level changes on the simulated clock.
+type Pin struct {
+	gpiotest.Pin
+	changes []Change
+}
+
+// Out sets the level of the pin and records a change.
+func (p *Pin) Out(l gpio.Level) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.changes) == 0 || p.L != l {
+		p.changes = append(p.changes, Change{Time: clock.Now(), Level: l})
+	}
+
+	p.L = l
+	return nil
+}
+
+// Changes returns the level changes of the pin in chronological order.
+func (p *Pin) Changes() []Change {
+	p.Lock()
+	defer p.Unlock()
+
+	changes := make([]Change, len(p.changes))
+	copy(changes, p.changes)
+	return changes
+}
+
+// LevelAt returns the level of the pin at t. It returns false if the pin wasn't set before t.
+func (p *Pin) LevelAt(t time.Time) (gpio.Level, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	level, ok := gpio.Low, false
+	for _, change := range p.changes {
+		if change.Time.After(t) {
+			break
+		}
+		level, ok = change.Level, true
+	}
+
+	return level, ok
+}
+
+// HighTime returns how long the pin was high until end.
+func (p *Pin) HighTime(end time.Time) time.Duration {
+	p.Lock()
+	defer p.Unlock()
+
+	var high time.Duration
+	for idx, change := range p.changes {
+		if change.Level != gpio.High {
+			continue
+		}
+
+		until := end
+		if idx+1 < len(p.changes) {
+			until = p.changes[idx+1].Time
+		}
+		high += until.Sub(change.Time)
+	}
+
+	return high
+}
+
+// pinSet holds a fake pin for each raspberry pi pin known to the scripts.
+type pinSet map[string]*Pin
+
+// newPinSet creates fake pins named like the variables of the rpi package, e.g. P1_38.
+func newPinSet() pinSet {
+	pins := make(pinSet)
+	pinType := reflect.TypeOf((*gpio.PinIO)(nil)).Elem()
+
+	for name, value := range symbols.Symbols[rpiPackage] {
+		if value.Type() == pinType {
+			pins[name] = &Pin{Pin: gpiotest.Pin{N: name, Num: -1}}
+		}
+	}
+
+	return pins
+}
+
+// exports returns the symbols replacing the pins of the rpi package with the fake pins.
+func (p pinSet) exports() interp.Exports {
+	pinType := reflect.TypeOf((*gpio.PinIO)(nil)).Elem()
+	values := make(map[string]reflect.Value, len(p))
+
+	for name, pin := range p {
+		value := reflect.New(pinType).Elem()
+		value.Set(reflect.ValueOf(gpio.PinIO(pin)))
+		values[name] = value
+	}
+
+	return interp.Exports{rpiPackage: values}
+}
+
+// used returns the names of the pins that were set, ordered by name.
+func (p pinSet) used() []string {
+	names := []string{}
+	for name, pin := range p {
+		if len(pin.Changes()) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
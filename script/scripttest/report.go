@@ -0,0 +1,193 @@
+package scripttest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// maxListed limits the pin changes and errors listed in the report.
+const maxListed = 12
+
+// check evaluates the expectations against the result.
+func check(res *Result, expect Expectations) []Check {
+	checks := []Check{}
+
+	if !expect.AllowErrors {
+		c := Check{Description: "no script errors", Passed: len(res.Errors) == 0}
+		if !c.Passed {
+			c.Got = fmt.Sprintf("%d errors", len(res.Errors))
+		}
+		checks = append(checks, c)
+	}
+
+	for _, exp := range expect.Pins {
+		want, _ := parseLevel(exp.Level)
+		c := Check{Description: fmt.Sprintf("pin %s is %s at %s", exp.Pin, strings.ToLower(exp.Level), offset(time.Duration(exp.At)))}
+
+		pin, ok := res.Pin(exp.Pin)
+		if !ok {
+			c.Got = "unknown pin"
+			checks = append(checks, c)
+			continue
+		}
+
+		level, ok := pin.LevelAt(res.Start.Add(time.Duration(exp.At)))
+		c.Passed = ok && level == want
+		if !ok {
+			c.Got = "not set yet"
+		} else if !c.Passed {
+			c.Got = levelName(level)
+		}
+		checks = append(checks, c)
+	}
+
+	for _, exp := range expect.Timers {
+		timer, ok := res.Timer(exp.Name)
+
+		if exp.State != "" {
+			c := Check{Description: fmt.Sprintf("timer %s is %s", exp.Name, exp.State)}
+			c.Passed = ok && timer.State == exp.State
+			if !ok {
+				c.Got = "unknown timer"
+			} else if !c.Passed {
+				c.Got = timer.State
+			}
+			checks = append(checks, c)
+		}
+
+		if exp.NextSwitch != nil {
+			c := Check{Description: fmt.Sprintf("timer %s switches next at %s", exp.Name, offset(time.Duration(*exp.NextSwitch)))}
+			switch {
+			case !ok:
+				c.Got = "unknown timer"
+			case timer.NextSwitch == nil:
+				c.Got = "not scheduled"
+			default:
+				got := timer.NextSwitch.Sub(res.Start)
+				c.Passed = got == time.Duration(*exp.NextSwitch)
+				if !c.Passed {
+					c.Got = offset(got)
+				}
+			}
+			checks = append(checks, c)
+		}
+	}
+
+	return checks
+}
+
+// offset formats a duration since the start of the simulation.
+func offset(d time.Duration) string {
+	return "+" + d.String()
+}
+
+// levelName returns "high" or "low".
+func levelName(level gpio.Level) string {
+	if level == gpio.High {
+		return "high"
+	}
+
+	return "low"
+}
+
+// WriteReport writes a readable summary of the simulation with the pin timelines,
+// the timers at the end, the published messages, the errors of the script and the checked expectations.
+func (r *Result) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "script %s\n", r.Script)
+	fmt.Fprintf(tw, "simulated %s to %s (%s), run interval %s\n",
+		r.Start.Format(time.DateTime), r.End.Format(time.DateTime), r.End.Sub(r.Start), r.Interval)
+	fmt.Fprintf(tw, "%d runs, %d events, %d errors\n", r.Runs, len(r.Events), len(r.Errors))
+
+	fmt.Fprintf(tw, "\npins\n")
+	pins := r.Pins()
+	if len(pins) == 0 {
+		fmt.Fprintf(tw, "  none set\n")
+	}
+	for _, name := range pins {
+		pin := r.pins[name]
+		changes := pin.Changes()
+		high := pin.HighTime(r.End)
+
+		fmt.Fprintf(tw, "  %s\t%d changes\thigh %s\tlow %s\tends %s\n",
+			name, len(changes), high, r.End.Sub(r.Start)-high, levelName(changes[len(changes)-1].Level))
+
+		timeline := []string{}
+		for idx, change := range changes {
+			if idx == maxListed {
+				timeline = append(timeline, fmt.Sprintf("… %d more", len(changes)-maxListed))
+				break
+			}
+			timeline = append(timeline, fmt.Sprintf("%s %s", offset(change.Time.Sub(r.Start)), levelName(change.Level)))
+		}
+		fmt.Fprintf(tw, "  \t%s\n", strings.Join(timeline, ", "))
+	}
+
+	fmt.Fprintf(tw, "\ntimers\n")
+	if len(r.Timers) == 0 {
+		fmt.Fprintf(tw, "  none\n")
+	}
+	for _, timer := range r.Timers {
+		next := "-"
+		if timer.NextSwitch != nil {
+			next = offset(timer.NextSwitch.Sub(r.Start))
+		}
+
+		actuator := "not registered"
+		if act := timer.Actuator; act != nil {
+			actuator = fmt.Sprintf("on %s, %d pulses", time.Duration(act.OnTime*float64(time.Second)).Round(time.Second), act.Pulses)
+		}
+
+		fmt.Fprintf(tw, "  %s\t%s\t%s\tnext switch %s\t%s\n", timer.Name, timer.Kind, timer.State, next, actuator)
+	}
+
+	if len(r.Published) > 0 {
+		fmt.Fprintf(tw, "\npublished\n")
+		for idx, msg := range r.Published {
+			if idx == maxListed {
+				fmt.Fprintf(tw, "  … %d more\n", len(r.Published)-maxListed)
+				break
+			}
+
+			retained := ""
+			if msg.Retained {
+				retained = "retained"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%q\t%s\n", offset(msg.Time.Sub(r.Start)), msg.Topic, msg.Payload, retained)
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(tw, "\nerrors\n")
+		for idx, ev := range r.Errors {
+			if idx == maxListed {
+				fmt.Fprintf(tw, "  … %d more\n", len(r.Errors)-maxListed)
+				break
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%v\n", offset(ev.Time.Sub(r.Start)), ev.Entrypoint, ev.Err)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nchecks\n")
+	for _, c := range r.Checks {
+		if c.Passed {
+			fmt.Fprintf(tw, "  ok\t%s\n", c.Description)
+		} else {
+			fmt.Fprintf(tw, "  FAIL\t%s\tgot %s\n", c.Description, c.Got)
+		}
+	}
+
+	if r.Failed() {
+		fmt.Fprintf(tw, "\nFAIL\n")
+	} else {
+		fmt.Fprintf(tw, "\nPASS\n")
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,174 @@
+package scripttest
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// Duration is a time.Duration written as "90s" or "1h30m" in a scenario file.
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.Wrap(err, "duration must be a string like \"90s\"")
+	}
+
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(dur)
+	return nil
+}
+
+// MarshalJSON writes the duration as string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Step sets sensor values at an offset from the start of the simulation.
+// Metrics not listed keep their previous value.
+type Step struct {
+	At     Duration           `json:"at"`
+	Values map[string]float64 `json:"values"`
+}
+
+// Message is a mqtt message delivered to OnMqttMessage and the subscribed handlers
+// at an offset from the start of the simulation.
+type Message struct {
+	At      Duration `json:"at"`
+	Topic   string   `json:"topic"`
+	Payload string   `json:"payload"`
+}
+
+// PinExpectation expects a pin to be at Level ("high" or "low") at an offset from the start.
+type PinExpectation struct {
+	Pin   string   `json:"pin"`
+	At    Duration `json:"at"`
+	Level string   `json:"level"`
+}
+
+// TimerExpectation expects the state of a timer at the end of the simulation.
+// State ("off" or "on") applies to switch timers, NextSwitch is the offset from the start.
+type TimerExpectation struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state,omitempty"`
+	NextSwitch *Duration `json:"next_switch,omitempty"`
+}
+
+// Expectations are checked after the simulation.
+type Expectations struct {
+	Pins   []PinExpectation   `json:"pins"`
+	Timers []TimerExpectation `json:"timers"`
+	// AllowErrors accepts errors returned by the script, otherwise they fail the test.
+	AllowErrors bool `json:"allow_errors"`
+}
+
+// Scenario describes a simulated run of a script.
+type Scenario struct {
+	// Start is the simulated time of the first run, defaults to the start of the current day.
+	Start time.Time `json:"start"`
+	// Duration is the simulated time span, defaults to one hour.
+	Duration Duration `json:"duration"`
+	// Interval is the run interval if the script doesn't define RunInterval, defaults to one second.
+	Interval Duration `json:"interval"`
+	// StaleAfter marks metrics without update as stale, 0 disables the check.
+	StaleAfter Duration `json:"stale_after"`
+
+	// Library holds the helper packages of the script, defaults to script.LoadLibrary("").
+	Library fs.FS `json:"-"`
+
+	Snapshots []Step    `json:"snapshots"`
+	Messages  []Message `json:"messages"`
+	// Retained are the retained messages by topic on the broker at the start.
+	Retained map[string]string `json:"retained"`
+	Expect   Expectations      `json:"expect"`
+}
+
+// LoadScenario reads a scenario from a json file.
+func LoadScenario(path string) (Scenario, error) {
+	var scenario Scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario, errors.Wrap(err, "read scenario")
+	}
+
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return scenario, errors.Wrapf(err, "parse scenario %s", path)
+	}
+
+	return scenario, nil
+}
+
+// withDefaults returns the scenario with defaults for unset fields.
+func (s Scenario) withDefaults() Scenario {
+	if s.Start.IsZero() {
+		now := time.Now()
+		s.Start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	if s.Duration <= 0 {
+		s.Duration = Duration(time.Hour)
+	}
+	if s.Interval <= 0 {
+		s.Interval = Duration(time.Second)
+	}
+
+	return s
+}
+
+// validate checks the metric names, pin levels and offsets of the scenario.
+func (s Scenario) validate() error {
+	for _, step := range s.Snapshots {
+		if step.At < 0 || step.At > s.Duration {
+			return errors.Errorf("snapshot at %s is outside of the simulation", time.Duration(step.At))
+		}
+		for name := range step.Values {
+			if _, ok := store.LookupMetric(name); !ok {
+				return errors.Errorf("snapshot at %s: unknown metric %q", time.Duration(step.At), name)
+			}
+		}
+	}
+
+	for _, msg := range s.Messages {
+		if msg.At < 0 || msg.At > s.Duration {
+			return errors.Errorf("message at %s is outside of the simulation", time.Duration(msg.At))
+		}
+	}
+
+	for _, exp := range s.Expect.Pins {
+		if _, err := parseLevel(exp.Level); err != nil {
+			return errors.Wrapf(err, "expectation of pin %s", exp.Pin)
+		}
+	}
+
+	for _, exp := range s.Expect.Timers {
+		if exp.State != "" && exp.State != "on" && exp.State != "off" {
+			return errors.Errorf("expectation of timer %s: invalid state %q, use on or off", exp.Name, exp.State)
+		}
+	}
+
+	return nil
+}
+
+// parseLevel parses "high" or "low".
+func parseLevel(value string) (gpio.Level, error) {
+	switch strings.ToLower(value) {
+	case "high":
+		return gpio.High, nil
+	case "low":
+		return gpio.Low, nil
+	}
+
+	return gpio.Low, errors.Errorf("invalid level %q, use high or low", value)
+}
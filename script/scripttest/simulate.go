@@ -0,0 +1,447 @@
+// Package scripttest runs a sensor script against a simulated clock, a scripted
+// sequence of sensor values and fake pins, so its logic can be tested without the hardware.
+//
+// The script sees the simulated time through time.Now, time.Since, time.Until,
+// time.Sleep and time.After, the timers of the types package use the same clock.
+// Pulses and sleeps advance the clock immediately. The pins of the rpi package are
+// replaced by fake pins recording their level changes and ScriptContext.Mqtt records the
+// published messages instead of sending them.
+//
+// The simulation replaces global state like the clock and the actuators,
+// so simulations must not run in parallel.
+package scripttest
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/api"
+	"github.com/denkhaus/sensor/broker"
+	"github.com/denkhaus/sensor/clock"
+	"github.com/denkhaus/sensor/script"
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/traefik/yaegi/interp"
+)
+
+// entrypointMqttHandler is the entrypoint of the events of handlers subscribed by the script.
+const entrypointMqttHandler = "mqtt handler"
+
+// Event is an entrypoint call or error of the simulation.
+type Event struct {
+	Time       time.Time
+	Entrypoint string
+	Detail     string
+	Err        error
+}
+
+// Check is the outcome of an expectation of the scenario.
+type Check struct {
+	Description string
+	Passed      bool
+	// Got describes the actual value if the check failed.
+	Got string
+}
+
+// Result is the outcome of a simulation.
+type Result struct {
+	Script   string
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration
+	Runs     int
+	// Events are all calls of event entrypoints in chronological order.
+	Events []Event
+	// Errors are all errors returned by the entrypoints in chronological order.
+	Errors []Event
+	Timers []api.Timer
+	Checks []Check
+	// Published are the mqtt messages published by the script in chronological order.
+	Published []Publication
+
+	pins pinSet
+}
+
+// Failed reports whether an expectation of the scenario failed.
+func (r *Result) Failed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pin returns the fake pin with the given name, e.g. P1_38.
+func (r *Result) Pin(name string) (*Pin, bool) {
+	pin, ok := r.pins[name]
+	return pin, ok
+}
+
+// Pins returns the names of the pins set by the script.
+func (r *Result) Pins() []string {
+	return r.pins.used()
+}
+
+// Timer returns the state of the timer with the given name at the end of the simulation.
+func (r *Result) Timer(name string) (api.Timer, bool) {
+	for _, timer := range r.Timers {
+		if timer.Name == name {
+			return timer, true
+		}
+	}
+
+	return api.Timer{}, false
+}
+
+// simulation is the state of a running simulation.
+type simulation struct {
+	name   string
+	runner *script.ScriptRunner
+	clock  *clock.Fake
+	mqtt   *fakeMqtt
+	result *Result
+	// timers are the names of the timers switched during the current entrypoint call
+	timers []string
+	// depth is the number of nested entrypoint calls
+	depth int
+}
+
+var (
+	activeMutex sync.Mutex
+	active      *simulation
+	listenOnce  sync.Once
+)
+
+// timerSwitched records a switched timer of the active simulation.
+func timerSwitched(name string, timer string) {
+	activeMutex.Lock()
+	defer activeMutex.Unlock()
+
+	if active != nil && active.name == name {
+		active.timers = append(active.timers, timer)
+	}
+}
+
+// simulatedTime sets the time of log entries to the simulated time.
+type simulatedTime struct {
+	clock *clock.Fake
+}
+
+func (h simulatedTime) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h simulatedTime) Fire(entry *logrus.Entry) error {
+	entry.Time = h.clock.Now()
+	return nil
+}
+
+// timeExports replaces the functions of the time package reading or waiting for the time.
+func timeExports() interp.Exports {
+	return interp.Exports{
+		"time/time": {
+			"Now":   reflect.ValueOf(clock.Now),
+			"Since": reflect.ValueOf(clock.Since),
+			"Until": reflect.ValueOf(clock.Until),
+			"Sleep": reflect.ValueOf(clock.Sleep),
+			"After": reflect.ValueOf(clock.After),
+		},
+	}
+}
+
+// Simulate runs the script at path as described by scenario.
+//
+// Setup is called at the start, Script at the run interval and the event entrypoints
+// for the snapshots and messages of the scenario and the switching timers. Messages are
+// also delivered to the handlers subscribed by the script. OnShutdown is
+// called at the end. The log of the script is written to log, which may be nil.
+//
+// Parameters:
+// - path: the path of the script.
+// - scenario: the simulated sensor values, messages and expectations.
+// - log: the writer for the log of the script.
+//
+// Returns:
+// - *Result: the pin timelines, timers, errors and checked expectations.
+// - error: an error if the script or scenario is invalid.
+func Simulate(path string, scenario Scenario, log io.Writer) (*Result, error) {
+	scenario = scenario.withDefaults()
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read script")
+	}
+
+	fake := clock.NewFake(scenario.Start)
+	defer clock.Set(clock.Set(fake))
+	types.Actuators().Clear()
+
+	if log == nil {
+		log = io.Discard
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(log)
+	logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, TimestampFormat: time.DateTime})
+	logger.AddHook(simulatedTime{clock: fake})
+
+	lib := scenario.Library
+	if lib == nil {
+		if lib, err = script.LoadLibrary(""); err != nil {
+			return nil, err
+		}
+	}
+
+	pins := newPinSet()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	runner, err := script.NewScriptRunner(name, string(content), lib, logger, timeExports(), pins.exports())
+	if err != nil {
+		return nil, errors.Wrap(err, "create script runner")
+	}
+	if !runner.Enabled() {
+		return nil, errors.Errorf("script %s is disabled by its Enabled variable", name)
+	}
+
+	// a ValueStore of capacity 0 keeps the last value only, so the script sees the values of the scenario
+	sensors := store.NewSensorStore(0, store.Registry())
+	sensors.SetStaleAfter(time.Duration(scenario.StaleAfter))
+
+	embedded := store.NewInMemoryEmbeddedStore()
+	if err := embedded.Open(); err != nil {
+		return nil, errors.Wrap(err, "open storage")
+	}
+	defer embedded.Close()
+
+	runner.Context().SensorStore = sensors
+	runner.Context().EmbeddedStore = embedded
+
+	interval := runner.Interval()
+	if interval == 0 {
+		interval = time.Duration(scenario.Interval)
+	}
+
+	result := &Result{
+		Script:   path,
+		Start:    scenario.Start,
+		End:      scenario.Start.Add(time.Duration(scenario.Duration)),
+		Interval: interval,
+		pins:     pins,
+	}
+
+	sim := &simulation{
+		name:   name,
+		runner: runner,
+		clock:  fake,
+		mqtt:   newFakeMqtt(fake, result, scenario.Retained),
+		result: result,
+	}
+	runner.Context().Mqtt = sim.mqtt
+
+	listenOnce.Do(func() {
+		types.OnTimer(timerSwitched)
+	})
+
+	activeMutex.Lock()
+	active = sim
+	activeMutex.Unlock()
+
+	defer func() {
+		activeMutex.Lock()
+		active = nil
+		activeMutex.Unlock()
+	}()
+
+	sim.run(scenario, sensors)
+
+	timers, err := api.Timers(embedded)
+	if err != nil {
+		return nil, err
+	}
+
+	sim.result.Timers = timers
+	sim.result.Checks = check(sim.result, scenario.Expect)
+	return sim.result, nil
+}
+
+// scheduled is a snapshot or message of the scenario.
+type scheduled struct {
+	at      time.Time
+	step    *Step
+	message *Message
+}
+
+// schedule returns the snapshots and messages of the scenario in chronological order.
+func schedule(scenario Scenario) []scheduled {
+	list := []scheduled{}
+	for idx := range scenario.Snapshots {
+		step := &scenario.Snapshots[idx]
+		list = append(list, scheduled{at: scenario.Start.Add(time.Duration(step.At)), step: step})
+	}
+	for idx := range scenario.Messages {
+		msg := &scenario.Messages[idx]
+		list = append(list, scheduled{at: scenario.Start.Add(time.Duration(msg.At)), message: msg})
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].at.Before(list[j].at)
+	})
+
+	return list
+}
+
+// run drives the script through the simulated time span.
+func (p *simulation) run(scenario Scenario, sensors store.SensorStore) {
+	res := p.result
+	events := schedule(scenario)
+
+	// the snapshots at the start are there before Setup
+	for len(events) > 0 && !events[0].at.After(res.Start) && events[0].step != nil {
+		p.apply(sensors, events[0].step)
+		events = events[1:]
+	}
+
+	if err := p.call("Setup", "", p.runner.CallSetup); err != nil {
+		return
+	}
+
+	next := res.Start
+	for {
+		if len(events) > 0 && !events[0].at.After(next) {
+			if events[0].at.After(res.End) {
+				break
+			}
+
+			p.clock.AdvanceTo(events[0].at)
+			p.handle(sensors, events[0])
+			events = events[1:]
+			continue
+		}
+
+		if next.After(res.End) {
+			break
+		}
+
+		p.clock.AdvanceTo(next)
+		res.Runs++
+		p.call("Script", "", p.runner.CallScript)
+
+		// like the script runner, the next run starts an interval after the run returned
+		next = p.clock.Now().Add(res.Interval)
+	}
+
+	p.clock.AdvanceTo(res.End)
+	p.callEntrypoint(script.EntrypointOnShutdown, "", store.Snapshot{})
+}
+
+// apply sets the sensor values of step.
+func (p *simulation) apply(sensors store.SensorStore, step *Step) {
+	for name, value := range step.Values {
+		metric, _ := store.LookupMetric(name)
+		sensors.Set(metric.ID, value)
+	}
+}
+
+// handle applies a snapshot or delivers a message of the scenario.
+func (p *simulation) handle(sensors store.SensorStore, ev scheduled) {
+	if ev.step != nil {
+		p.apply(sensors, ev.step)
+		snapshot := sensors.Snapshot()
+		p.callEntrypoint(script.EntrypointOnSensorData, "", snapshot, snapshot)
+		return
+	}
+
+	topic, payload := ev.message.Topic, []byte(ev.message.Payload)
+	for _, filter := range p.runner.MqttTopics() {
+		if broker.MatchTopic(filter, topic) {
+			p.callEntrypoint(script.EntrypointOnMqttMessage, topic, store.Snapshot{}, topic, payload)
+			break
+		}
+	}
+
+	// the handlers subscribed by the script receive the message after OnMqttMessage
+	p.mqtt.deliver(topic, payload)
+	p.call(entrypointMqttHandler, topic, nil)
+}
+
+// callEntrypoint calls an optional entrypoint if the script defines it.
+func (p *simulation) callEntrypoint(name string, detail string, snapshot store.Snapshot, args ...interface{}) {
+	if !p.runner.HasEntrypoint(name) {
+		return
+	}
+
+	if snapshot.Time().IsZero() {
+		snapshot = p.runner.Context().SensorStore.Snapshot()
+	}
+
+	p.call(name, detail, func(ctx context.Context) error {
+		return p.runner.CallEntrypoint(ctx, name, snapshot, args...)
+	})
+}
+
+// call calls an entrypoint, records errors and afterwards calls OnTimer for the switched timers
+// and the handlers of the published messages. A nil fn only calls those.
+func (p *simulation) call(name string, detail string, fn func(ctx context.Context) error) error {
+	if p.depth == 0 {
+		p.mqtt.delivered = 0
+	}
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+
+	now := p.clock.Now()
+	var err error
+	if fn != nil {
+		err = fn(context.Background())
+		p.record(name, detail, now, err)
+	}
+
+	activeMutex.Lock()
+	timers := p.timers
+	p.timers = nil
+	activeMutex.Unlock()
+
+	for _, timer := range timers {
+		p.callEntrypoint(script.EntrypointOnTimer, timer, store.Snapshot{}, timer)
+	}
+
+	for {
+		msg, ok, e := p.mqtt.next()
+		if e != nil {
+			p.result.Errors = append(p.result.Errors, Event{Time: p.clock.Now(), Entrypoint: entrypointMqttHandler, Err: e})
+		}
+		if !ok {
+			break
+		}
+
+		p.call(entrypointMqttHandler, msg.topic, func(ctx context.Context) error {
+			return p.runner.CallHandler(ctx, msg.handler, msg.topic, msg.payload)
+		})
+	}
+
+	return err
+}
+
+// record records an entrypoint call and its error.
+func (p *simulation) record(name string, detail string, now time.Time, err error) {
+	if name != "Setup" && name != "Script" {
+		p.result.Events = append(p.result.Events, Event{Time: now, Entrypoint: name, Detail: detail, Err: err})
+	}
+	if err != nil {
+		p.result.Errors = append(p.result.Errors, Event{Time: now, Entrypoint: name, Detail: detail, Err: err})
+	}
+}
@@ -0,0 +1,37 @@
+package scripttest
+
+import (
+	"strings"
+	"testing"
+)
+
+// Run simulates the script at path in a Go test and logs the report.
+//
+// The test fails if the script can't be loaded, returns errors or an
+// expectation of the scenario isn't met. The result allows further assertions:
+//
+//	res := scripttest.Run(t, "sensor_script.go", scenario)
+//	pin, _ := res.Pin("P1_38")
+//	if level, _ := pin.LevelAt(res.Start.Add(5 * time.Minute)); level != gpio.Low {
+//		t.Errorf("pump is on at night")
+//	}
+func Run(t testing.TB, path string, scenario Scenario) *Result {
+	t.Helper()
+
+	res, err := Simulate(path, scenario, nil)
+	if err != nil {
+		t.Fatalf("simulate %s: %v", path, err)
+	}
+
+	var report strings.Builder
+	if err := res.WriteReport(&report); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+
+	t.Log("\n" + report.String())
+	if res.Failed() {
+		t.Errorf("script test of %s failed", path)
+	}
+
+	return res
+}
@@ -0,0 +1,131 @@
+package script
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/types"
+	"github.com/sirupsen/logrus"
+)
+
+// watchdog bounds each run of a script by a deadline and switches the actuators
+// of the script off if a run ignores it and stalls the script loop.
+type watchdog struct {
+	logger  *logrus.Logger
+	handler *errorHandler
+	timeout time.Duration
+	limit   time.Duration
+
+	mutex   sync.Mutex
+	started time.Time
+	tripped bool
+}
+
+func newWatchdog(logger *logrus.Logger, handler *errorHandler, timeout time.Duration, limit time.Duration) *watchdog {
+	return &watchdog{
+		logger:  logger,
+		handler: handler,
+		timeout: timeout,
+		limit:   limit,
+	}
+}
+
+// Run calls fn with a context bounded by the run timeout and logs an overrun.
+func (p *watchdog) Run(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	start := p.begin()
+	err := fn(ctx)
+	p.end()
+
+	if elapsed := time.Since(start); p.timeout > 0 && elapsed > p.timeout {
+		metrics.ScriptOverruns.WithLabelValues(p.handler.name).Inc()
+		p.handler.overrun()
+		p.logger.Warnf("script-runner: %s run took %s, exceeding the timeout of %s", name, elapsed.Round(time.Millisecond), p.timeout)
+	}
+
+	return err
+}
+
+func (p *watchdog) begin() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.started = time.Now()
+	return p.started
+}
+
+// end resets the watchdog, actuators switched off by it are handed back to their timers.
+func (p *watchdog) end() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.started = time.Time{}
+	if !p.tripped {
+		return
+	}
+
+	p.tripped = false
+	p.handler.setStalled(false)
+	p.logger.Warn("script-watchdog: stalled run returned")
+
+	// actuators of a suspended script stay off
+	if !p.handler.SafeMode() {
+		types.Actuators().Resume(p.handler.name)
+	}
+}
+
+// Watch checks the duration of the current run until ctx is done.
+func (p *watchdog) Watch(ctx context.Context) error {
+	if p.limit <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(p.limit / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("script-watchdog: done received -> closing")
+			return nil
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+func (p *watchdog) check() {
+	p.mutex.Lock()
+	if p.tripped || p.started.IsZero() || time.Since(p.started) < p.limit {
+		p.mutex.Unlock()
+		return
+	}
+
+	p.tripped = true
+	p.handler.setStalled(true)
+	stalled := time.Since(p.started)
+	p.mutex.Unlock()
+
+	// switching the actuators may block, so the run must be able to end meanwhile
+	p.logger.Errorf("script-watchdog: script run stalled for %s, switching the actuators of the script off", stalled.Round(time.Second))
+
+	if err := types.Actuators().SafeState(p.handler.name); err != nil {
+		p.logger.Errorf("script-watchdog: %v", err)
+	}
+
+	p.mutex.Lock()
+	ended := !p.tripped
+	p.mutex.Unlock()
+
+	// the run ended before the actuators were switched off, so end resumed them too early
+	if ended && !p.handler.SafeMode() {
+		types.Actuators().Resume(p.handler.name)
+	}
+}
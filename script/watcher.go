@@ -0,0 +1,102 @@
+package script
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// reloadDelay collects the events of a single save, editors often write a file in several steps.
+const reloadDelay = 500 * time.Millisecond
+
+// WatchScript watches the script file and evaluates it into a fresh interpreter on each change.
+//
+// The directory of the script is watched, so the file may be replaced by a rename.
+// Only scripts that evaluate cleanly are sent to the returned channel, which holds
+// the latest of them until it is received. Otherwise the error is logged and the
+// running script is kept.
+//
+// Parameters:
+// - ctx: the context, watching stops when it is done.
+// - logger: the logger to use.
+// - path: the absolute path of the script.
+// - content: the content of the running script, unchanged saves are ignored.
+// - load: evaluates the script file into a new ScriptRunner.
+// - eg: the errgroup running the watcher.
+//
+// Returns:
+// - <-chan *ScriptRunner: the channel receiving the changed scripts.
+// - error: an error if the watcher could not be created.
+func WatchScript(
+	ctx context.Context,
+	logger *logrus.Logger,
+	path string,
+	content string,
+	load func() (*ScriptRunner, error),
+	eg *errgroup.Group,
+) (<-chan *ScriptRunner, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "create script watcher")
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, errors.Wrap(err, "watch script directory")
+	}
+
+	reloads := make(chan *ScriptRunner, 1)
+
+	eg.Go(func() error {
+		defer watcher.Close()
+
+		timer := time.NewTimer(reloadDelay)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("script-watcher: done received -> closing")
+				return nil
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return nil
+				}
+				logger.Warnf("script-watcher: %v", err)
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return nil
+				}
+				if filepath.Clean(ev.Name) == path && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+					timer.Reset(reloadDelay)
+				}
+			case <-timer.C:
+				runner, err := load()
+				if err != nil {
+					logger.Errorf("script-watcher: keep running script: %v", err)
+					continue
+				}
+				if runner.content == content {
+					continue
+				}
+
+				content = runner.content
+				logger.Infof("script-watcher: %s changed", path)
+
+				// replace a change the runner didn't receive yet
+				select {
+				case <-reloads:
+				default:
+				}
+				reloads <- runner
+			}
+		}
+	})
+
+	return reloads, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/denkhaus/sensor/script"
+	"github.com/denkhaus/sensor/script/scripttest"
+	"github.com/pkg/errors"
+)
+
+var scriptCommands = map[string]Command{
+	"check": scriptCheckCommand,
+	"test":  scriptTestCommand,
+}
+
+// scriptCommand runs the script subcommand given as first argument, e.g. "sensor script test".
+func scriptCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: sensor script check|test [flags] <script>")
+	}
+
+	cmd, ok := scriptCommands[args[0]]
+	if !ok {
+		return errors.Errorf("unknown script command %q", args[0])
+	}
+
+	return cmd(args[1:])
+}
+
+// scriptCheckCommand validates scripts without running them and prints each problem as file:line:column: message.
+// It fails if a script has problems, so it can be used as pre-commit hook.
+func scriptCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("script check", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: sensor script check <script>...")
+	}
+
+	lib, err := script.LoadLibrary(cnf.Script.Lib)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		problems, err := script.Check(path, lib)
+		if err != nil {
+			return err
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d scripts have problems", failed, fs.NArg())
+	}
+
+	return nil
+}
+
+// scriptTestCommand runs a script against a simulated clock, sensor values and pins
+// and prints a report. It fails if an expectation of the scenario isn't met.
+func scriptTestCommand(args []string) error {
+	fs := flag.NewFlagSet("script test", flag.ContinueOnError)
+	scenarioPath := fs.String("scenario", "", "json file with the simulated sensor values, messages and expectations")
+	start := fs.String("start", "", "simulated start time, RFC3339 or YYYY-MM-DD (default: from scenario or today)")
+	duration := fs.Duration("duration", 0, "simulated time span (default: from scenario or 1h)")
+	interval := fs.Duration("interval", 0, "run interval if the script doesn't define RunInterval (default: from scenario or -script-run-interval)")
+	verbose := fs.Bool("v", false, "print the log of the script with simulated timestamps to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: sensor script test [flags] <script>")
+	}
+
+	var scenario scripttest.Scenario
+	if *scenarioPath != "" {
+		var err error
+		if scenario, err = scripttest.LoadScenario(*scenarioPath); err != nil {
+			return err
+		}
+	}
+
+	if *start != "" {
+		t, err := parseExportTime(*start)
+		if err != nil {
+			return errors.Wrap(err, "start")
+		}
+		scenario.Start = t
+	}
+	if *duration > 0 {
+		scenario.Duration = scripttest.Duration(*duration)
+	}
+	if *interval > 0 {
+		scenario.Interval = scripttest.Duration(*interval)
+	}
+	if scenario.Interval == 0 {
+		scenario.Interval = scripttest.Duration(time.Second * time.Duration(cnf.Script.RunInterval))
+	}
+
+	lib, err := script.LoadLibrary(cnf.Script.Lib)
+	if err != nil {
+		return err
+	}
+	scenario.Library = lib
+
+	var log io.Writer
+	if *verbose {
+		log = os.Stderr
+	}
+
+	res, err := scripttest.Simulate(fs.Arg(0), scenario, log)
+	if err != nil {
+		return err
+	}
+
+	if err := res.WriteReport(os.Stdout); err != nil {
+		return errors.Wrap(err, "write report")
+	}
+
+	if res.Failed() {
+		return errors.New("expectations not met")
+	}
+
+	return nil
+}
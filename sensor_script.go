@@ -62,10 +62,10 @@ func processDosePump(ctx *types.ScriptContext, pumpStateID string, pinio gpio.Pi
 	}
 
 	fnCondition := func() bool {
-		hum := ctx.SensorStore.Get(store.Humidity)
+		hum := ctx.Snapshot.Get(store.Humidity)
 
 		if hum >= 50.0 {
-			cond := ctx.SensorStore.Get(store.ConductivityWeighted)
+			cond := ctx.Snapshot.Get(store.ConductivityWeighted)
 			return cond >= ECMinThreshold && cond < ECMaxThreshold
 		} else {
 			ctx.Logger.Warnf("humidity %f is too low", hum)
@@ -132,11 +132,11 @@ func Setup(ctx *types.ScriptContext) error {
 }
 
 func Script(ctx *types.ScriptContext) error {
-	condWeighted := ctx.SensorStore.Get(store.ConductivityWeighted)
-	cond := ctx.SensorStore.Get(store.Conductivity)
-	temp := ctx.SensorStore.Get(store.Temperature)
-	hum := ctx.SensorStore.Get(store.Humidity)
-	tds := ctx.SensorStore.Get(store.TDS)
+	condWeighted := ctx.Snapshot.Get(store.ConductivityWeighted)
+	cond := ctx.Snapshot.Get(store.Conductivity)
+	temp := ctx.Snapshot.Get(store.Temperature)
+	hum := ctx.Snapshot.Get(store.Humidity)
+	tds := ctx.Snapshot.Get(store.TDS)
 
 	ctx.Logger.Infof("EC:[w: %f|r: %f], Humidity: %f, TDS: %f, Temp: %f", condWeighted, cond, hum, tds, temp)
 
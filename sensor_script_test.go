@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denkhaus/sensor/script/scripttest"
+	"github.com/denkhaus/sensor/types"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// noon keeps the aqua pumps out of the night mode of durationCallback.
+var noon = time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+
+func sensorScriptScenario(humidity float64, conductivity float64) scripttest.Scenario {
+	return scripttest.Scenario{
+		Start:    noon,
+		Duration: scripttest.Duration(10 * time.Minute),
+		Snapshots: []scripttest.Step{{
+			Values: map[string]float64{
+				"humidity":              humidity,
+				"temperature":           20,
+				"conductivity_weighted": conductivity,
+			},
+		}},
+	}
+}
+
+// expectLevel fails the test if the pin isn't at level at the offset from the start.
+func expectLevel(t *testing.T, res *scripttest.Result, name string, offset time.Duration, level gpio.Level) {
+	t.Helper()
+
+	pin, ok := res.Pin(name)
+	if !ok {
+		t.Fatalf("pin %s not used by the script", name)
+	}
+
+	if got, ok := pin.LevelAt(res.Start.Add(offset)); !ok || got != level {
+		t.Errorf("pin %s at +%s: got %s, want %s", name, offset, got, level)
+	}
+}
+
+func TestSensorScriptDosesWithinConductivityRange(t *testing.T) {
+	res := scripttest.Run(t, "sensor_script.go", sensorScriptScenario(60, 0.6))
+
+	// the dose pump is inverted: a pulse of 3s on initialize and after the wait duration of 5m
+	expectLevel(t, res, "P1_35", time.Second, gpio.Low)
+	expectLevel(t, res, "P1_35", 10*time.Second, gpio.High)
+	expectLevel(t, res, "P1_35", 5*time.Minute+5*time.Second, gpio.Low)
+
+	// the greenhouse pump is inverted: on for 20s after 5m off
+	expectLevel(t, res, "P1_38", time.Minute, gpio.High)
+	expectLevel(t, res, "P1_38", 5*time.Minute+10*time.Second, gpio.Low)
+	expectLevel(t, res, "P1_38", 6*time.Minute, gpio.High)
+
+	timer, ok := res.Timer(DosePumpStateIDDefault)
+	if !ok || timer.Actuator == nil {
+		t.Fatalf("timer %s not found", DosePumpStateIDDefault)
+	}
+	if timer.Actuator.Pulses != 2 {
+		t.Errorf("dose pump pulses: got %d, want 2", timer.Actuator.Pulses)
+	}
+
+	timer, ok = res.Timer(AquaPumpStateIDGreenhouse)
+	if !ok {
+		t.Fatalf("timer %s not found", AquaPumpStateIDGreenhouse)
+	}
+	if timer.State != types.SwitchTimerStateOff.String() || timer.NextSwitch == nil || !timer.NextSwitch.After(res.End) {
+		t.Errorf("greenhouse pump: got state %s, next switch %v", timer.State, timer.NextSwitch)
+	}
+}
+
+func TestSensorScriptSkipsDosing(t *testing.T) {
+	for name, scenario := range map[string]scripttest.Scenario{
+		"dry soil":          sensorScriptScenario(40, 0.6),
+		"high conductivity": sensorScriptScenario(60, 1.5),
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := scripttest.Run(t, "sensor_script.go", scenario)
+
+			pin, ok := res.Pin("P1_35")
+			if !ok {
+				t.Fatal("dose pump pin not used by the script")
+			}
+			if high := pin.HighTime(res.End); high != res.End.Sub(res.Start) {
+				t.Errorf("dose pump was active for %s", res.End.Sub(res.Start)-high)
+			}
+
+			timer, ok := res.Timer(DosePumpStateIDDefault)
+			if !ok || timer.Actuator == nil || timer.Actuator.Pulses != 0 {
+				t.Errorf("dose pump pulsed: %+v", timer.Actuator)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/denkhaus/sensor/metrics"
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// output is a Sink with its own buffer and goroutine.
+type output struct {
+	sink    Sink
+	queue   chan store.Snapshot
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// Dispatcher is a Sink fanning out snapshots to several sinks.
+//
+// Each sink has its own buffer and is fed by its own goroutine, so a slow or
+// failing sink neither blocks the caller nor the other sinks. If the buffer
+// of a sink is full, the snapshot is dropped for this sink.
+type Dispatcher struct {
+	logger  *logrus.Logger
+	outputs []*output
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher creates a new Dispatcher.
+//
+// Parameters:
+// - logger: the logger to use.
+// - bufferSize: the number of snapshots buffered per sink.
+// - sinks: the sinks to dispatch to.
+//
+// Returns:
+// - *Dispatcher: the newly created Dispatcher.
+func NewDispatcher(logger *logrus.Logger, bufferSize int, sinks ...Sink) *Dispatcher {
+	dispatcher := &Dispatcher{logger: logger}
+	for _, sink := range sinks {
+		dispatcher.outputs = append(dispatcher.outputs, &output{
+			sink:  sink,
+			queue: make(chan store.Snapshot, bufferSize),
+		})
+	}
+
+	return dispatcher
+}
+
+// Name returns "dispatcher".
+func (p *Dispatcher) Name() string {
+	return "dispatcher"
+}
+
+// Start starts all sinks. An error of any sink is returned, since it indicates a misconfiguration.
+// The sinks started before the failing one are closed again.
+func (p *Dispatcher) Start(ctx context.Context) error {
+	for idx, out := range p.outputs {
+		if err := out.sink.Start(ctx); err != nil {
+			p.stop(p.outputs[:idx])
+			// a later Close must not close the queues again
+			p.outputs = nil
+			return errors.Wrapf(err, "start sink %s", out.sink.Name())
+		}
+
+		p.logger.Infof("sink-%s: started", out.sink.Name())
+
+		p.wg.Add(1)
+		go func(out *output) {
+			defer p.wg.Done()
+			for snapshot := range out.queue {
+				p.publish(out, snapshot)
+			}
+		}(out)
+	}
+
+	return nil
+}
+
+// publish writes snapshot to the sink of out. Errors and panics are logged, so they
+// don't affect the other sinks.
+func (p *Dispatcher) publish(out *output, snapshot store.Snapshot) {
+	defer func() {
+		if r := recover(); r != nil {
+			out.failed.Add(1)
+			p.logger.Errorf("sink-%s: panic: %v", out.sink.Name(), r)
+		}
+	}()
+
+	if err := out.sink.Publish(snapshot); err != nil {
+		out.failed.Add(1)
+		p.logger.Warnf("sink-%s: %v", out.sink.Name(), err)
+	}
+}
+
+// Publish queues snapshot for all sinks without blocking.
+func (p *Dispatcher) Publish(snapshot store.Snapshot) error {
+	for _, out := range p.outputs {
+		select {
+		case out.queue <- snapshot:
+		default:
+			out.dropped.Add(1)
+			metrics.Dropped.WithLabelValues("sink_" + out.sink.Name()).Inc()
+			p.logger.Warnf("sink-%s: buffer full, dropping snapshot", out.sink.Name())
+		}
+	}
+
+	return nil
+}
+
+// SinkStatus describes the health of a sink.
+type SinkStatus struct {
+	Name     string `json:"name"`
+	Buffered int    `json:"buffered"`
+	Dropped  uint64 `json:"dropped"`
+	Failed   uint64 `json:"failed"`
+}
+
+// Status returns the status of all sinks.
+func (p *Dispatcher) Status() []SinkStatus {
+	status := make([]SinkStatus, 0, len(p.outputs))
+	for _, out := range p.outputs {
+		status = append(status, SinkStatus{
+			Name:     out.sink.Name(),
+			Buffered: len(out.queue),
+			Dropped:  out.dropped.Load(),
+			Failed:   out.failed.Load(),
+		})
+	}
+
+	return status
+}
+
+// Close waits until all buffered snapshots are written and closes all sinks.
+func (p *Dispatcher) Close() error {
+	return p.stop(p.outputs)
+}
+
+// stop closes the queues of outputs, waits until the buffered snapshots are written
+// and closes the sinks. The first error is returned.
+func (p *Dispatcher) stop(outputs []*output) error {
+	for _, out := range outputs {
+		close(out.queue)
+	}
+	p.wg.Wait()
+
+	var result error
+	for _, out := range outputs {
+		if err := out.sink.Close(); err != nil {
+			p.logger.Warnf("sink-%s: close: %v", out.sink.Name(), err)
+			if result == nil {
+				result = err
+			}
+		}
+	}
+
+	return result
+}
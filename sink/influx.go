@@ -0,0 +1,331 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDatagramSize keeps udp datagrams below the usual MTU.
+const maxDatagramSize = 1400
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxSink writes snapshots in influxdb line protocol to the http write api
+// of influxdb 1.x or 2.x (or compatible databases like VictoriaMetrics), or to a udp socket.
+type influxSink struct {
+	config *config.Config
+	logger *logrus.Logger
+	client *http.Client
+	conn   net.Conn
+
+	mutex sync.Mutex
+	lines []string
+	// flushMutex keeps the order of batches written by Publish and the periodic flush
+	flushMutex sync.Mutex
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewInfluxSink creates a Sink writing line protocol as configured in config.Influx.
+//
+// Parameters:
+// - logger: the logger to use.
+// - config: the service configuration.
+//
+// Returns:
+// - Sink: the newly created Sink.
+func NewInfluxSink(logger *logrus.Logger, config *config.Config) Sink {
+	return &influxSink{
+		config: config,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
+
+func (p *influxSink) Name() string {
+	return "influx"
+}
+
+// Start validates the configuration, opens the udp socket or starts the
+// periodic flush of batches to the http write api.
+func (p *influxSink) Start(ctx context.Context) error {
+	influx := p.config.Influx
+
+	endpoint, err := url.Parse(influx.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid influx url")
+	}
+
+	switch endpoint.Scheme {
+	case "udp":
+		conn, err := net.Dial("udp", endpoint.Host)
+		if err != nil {
+			return errors.Wrap(err, "open influx udp socket")
+		}
+		p.conn = conn
+		return nil
+	case "http", "https":
+	default:
+		return errors.Errorf("unsupported influx url scheme %q, use http, https or udp", endpoint.Scheme)
+	}
+
+	if influx.API != 1 && influx.API != 2 {
+		return errors.Errorf("unsupported influx api version %d, use 1 or 2", influx.API)
+	}
+
+	if influx.BatchSize <= 0 {
+		return errors.Errorf("invalid influx batch size %d", influx.BatchSize)
+	}
+
+	p.client = &http.Client{Timeout: time.Second * time.Duration(influx.Timeout)}
+
+	if influx.FlushInterval > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+
+			ticker := time.NewTicker(time.Second * time.Duration(influx.FlushInterval))
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-p.done:
+					return
+				case <-ticker.C:
+					if err := p.flush(ctx); err != nil {
+						p.logger.Warnf("sink-influx: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
+	return nil
+}
+
+// encode returns a point in line protocol for each metric of the snapshot:
+//
+//	<measurement>,device=<device>,metric=<metric>,site=<site> value=<value>,raw=<raw>,quality="<quality>" <ns>
+func (p *influxSink) encode(snapshot store.Snapshot) []string {
+	influx := p.config.Influx
+	lines := []string{}
+
+	for _, reading := range snapshot.Readings() {
+		if reading.Quality == store.QualityMissing {
+			continue
+		}
+
+		var line strings.Builder
+		line.WriteString(measurementEscaper.Replace(influx.Measurement))
+		if reading.Metric.Device != "" {
+			fmt.Fprintf(&line, ",device=%s", tagEscaper.Replace(reading.Metric.Device))
+		}
+		fmt.Fprintf(&line, ",metric=%s", tagEscaper.Replace(reading.Metric.ID.String()))
+		if influx.Site != "" {
+			fmt.Fprintf(&line, ",site=%s", tagEscaper.Replace(influx.Site))
+		}
+
+		fmt.Fprintf(&line, " value=%s,raw=%s,quality=\"%s\" %d",
+			strconv.FormatFloat(reading.Value, 'f', -1, 64),
+			strconv.FormatFloat(reading.Raw, 'f', -1, 64),
+			stringEscaper.Replace(reading.Quality.String()),
+			snapshot.Time().UnixNano(),
+		)
+
+		lines = append(lines, line.String())
+	}
+
+	return lines
+}
+
+// Publish sends the snapshot by udp, or adds it to the batch, which is written
+// to the http write api when it is full.
+func (p *influxSink) Publish(snapshot store.Snapshot) error {
+	lines := p.encode(snapshot)
+
+	if p.conn != nil {
+		return p.sendDatagrams(lines)
+	}
+
+	p.mutex.Lock()
+	p.lines = append(p.lines, lines...)
+	full := len(p.lines) >= p.config.Influx.BatchSize
+	p.mutex.Unlock()
+
+	if !full {
+		return nil
+	}
+
+	return p.flush(context.Background())
+}
+
+// sendDatagrams sends the lines in as few datagrams as possible.
+func (p *influxSink) sendDatagrams(lines []string) error {
+	var buf bytes.Buffer
+	send := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := p.conn.Write(buf.Bytes())
+		buf.Reset()
+		return errors.Wrap(err, "influx udp write")
+	}
+
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line)+1 > maxDatagramSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return send()
+}
+
+// flush writes the current batch to the http write api.
+// If all retries fail, the batch is dropped, so memory doesn't grow while the database is down.
+func (p *influxSink) flush(ctx context.Context) error {
+	p.flushMutex.Lock()
+	defer p.flushMutex.Unlock()
+
+	p.mutex.Lock()
+	lines := p.lines
+	p.lines = nil
+	p.mutex.Unlock()
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	if p.config.Influx.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return errors.Wrap(err, "gzip influx batch")
+		}
+		if err := zw.Close(); err != nil {
+			return errors.Wrap(err, "gzip influx batch")
+		}
+		body = buf.Bytes()
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.config.Influx.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "%d points dropped", len(lines))
+			case <-time.After(time.Second << (attempt - 1)):
+			}
+		}
+
+		var retry bool
+		if retry, err = p.write(ctx, body); err == nil || !retry {
+			break
+		}
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "%d points dropped", len(lines))
+	}
+
+	return nil
+}
+
+// write posts body to the write api and reports whether a failed request may be retried.
+func (p *influxSink) write(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.writeURL(), bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "create influx request")
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if p.config.Influx.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	influx := p.config.Influx
+	if influx.API == 2 && influx.Token != "" {
+		req.Header.Set("Authorization", "Token "+influx.Token)
+	}
+	if influx.API == 1 && influx.Username != "" {
+		req.SetBasicAuth(influx.Username, influx.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, errors.Wrap(err, "influx write")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, errors.Errorf("influx write: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// writeURL returns the url of the v1 or v2 write api.
+func (p *influxSink) writeURL() string {
+	influx := p.config.Influx
+	query := url.Values{}
+	query.Set("precision", "ns")
+
+	path := "/write"
+	if influx.API == 2 {
+		path = "/api/v2/write"
+		query.Set("org", influx.Org)
+		query.Set("bucket", influx.Bucket)
+	} else {
+		query.Set("db", influx.Database)
+		if influx.RetentionPolicy != "" {
+			query.Set("rp", influx.RetentionPolicy)
+		}
+	}
+
+	return strings.TrimSuffix(influx.URL, "/") + path + "?" + query.Encode()
+}
+
+// Close writes the pending batch and closes the udp socket.
+func (p *influxSink) Close() error {
+	close(p.done)
+	p.wg.Wait()
+
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+
+	if p.client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.config.Influx.Timeout))
+	defer cancel()
+	return p.flush(ctx)
+}
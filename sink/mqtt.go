@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/denkhaus/sensor/broker"
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/store"
+	"github.com/denkhaus/sensor/types"
+	"github.com/pkg/errors"
+)
+
+// mqttSink publishes snapshots and actuator states to the mqtt broker.
+type mqttSink struct {
+	broker     *broker.Broker
+	config     *config.Config
+	linkStatus broker.LinkStatusFunc
+}
+
+// NewMqttSink creates a Sink publishing to the given broker.
+//
+// Parameters:
+// - broker: the mqtt broker, which is connected by Start.
+// - config: the service configuration.
+// - linkStatus: reports the sensor link status for the heartbeat.
+//
+// Returns:
+// - Sink: the newly created Sink.
+func NewMqttSink(broker *broker.Broker, config *config.Config, linkStatus broker.LinkStatusFunc) Sink {
+	return &mqttSink{
+		broker:     broker,
+		config:     config,
+		linkStatus: linkStatus,
+	}
+}
+
+func (p *mqttSink) Name() string {
+	return "mqtt"
+}
+
+// Start connects to the broker, which publishes the discovery messages on each (re)connect,
+// handles remote commands and starts the replay of buffered messages and the heartbeat.
+func (p *mqttSink) Start(ctx context.Context) error {
+	if err := p.broker.OpenQueue(store.Embedded()); err != nil {
+		return errors.Wrap(err, "mqtt queue error")
+	}
+
+	if err := p.broker.Connect(); err != nil {
+		return err
+	}
+
+	if err := p.broker.HandleCommands(types.Actuators()); err != nil {
+		return errors.Wrap(err, "mqtt commands error")
+	}
+
+	go p.broker.RunQueue(ctx)
+
+	if p.config.Mqtt.Heartbeat > 0 {
+		go p.broker.RunHeartbeat(ctx,
+			time.Second*time.Duration(p.config.Mqtt.Heartbeat),
+			p.linkStatus,
+		)
+	}
+
+	return nil
+}
+
+// Publish publishes the snapshot and the states of the actuators.
+func (p *mqttSink) Publish(snapshot store.Snapshot) error {
+	if err := p.broker.PublishSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	return p.broker.PublishActuators(store.Embedded())
+}
+
+func (p *mqttSink) Close() error {
+	p.broker.Close()
+	return nil
+}
@@ -0,0 +1,19 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/denkhaus/sensor/store"
+)
+
+// Sink is an output the snapshots of each poll cycle are written to.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Start connects the sink. Background work has to stop when ctx is done.
+	Start(ctx context.Context) error
+	// Publish writes the snapshot of a poll cycle.
+	Publish(snapshot store.Snapshot) error
+	// Close flushes pending data and releases the resources of the sink.
+	Close() error
+}
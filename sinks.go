@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/denkhaus/sensor/broker"
+	"github.com/denkhaus/sensor/config"
+	"github.com/denkhaus/sensor/sink"
+	"github.com/pkg/errors"
+)
+
+// createSinks creates the output sinks enabled in the configuration.
+//
+// Parameters:
+// - config: the service configuration.
+// - reader: the DataReader, which reports the sensor link status.
+//
+// Returns:
+// - []sink.Sink: the enabled sinks.
+// - *broker.Broker: the mqtt broker, nil if the mqtt sink is disabled.
+// - error: an error if a sink is unknown or enabled twice.
+func createSinks(config *config.Config, reader *DataReader) ([]sink.Sink, *broker.Broker, error) {
+	sinks := []sink.Sink{}
+	var mqttBroker *broker.Broker
+	enabled := make(map[string]bool)
+
+	for _, name := range config.Sinks.Enabled {
+		name = strings.TrimSpace(name)
+		if enabled[name] {
+			return nil, nil, errors.Errorf("sink %s is enabled twice", name)
+		}
+		enabled[name] = true
+
+		switch name {
+		case "mqtt":
+			mqttBroker = broker.New(logger, config, broker.BuildInfo{
+				Version: BuildVersion,
+				Commit:  BuildCommit,
+				Date:    BuildDate,
+			})
+			sinks = append(sinks, sink.NewMqttSink(mqttBroker, config, reader.linkStatus(config)))
+		case "influx":
+			sinks = append(sinks, sink.NewInfluxSink(logger, config))
+		default:
+			return nil, nil, errors.Errorf("unknown sink %q", name)
+		}
+	}
+
+	return sinks, mqttBroker, nil
+}
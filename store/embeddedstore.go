@@ -1,10 +1,12 @@
 package store
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
-
 	"path/filepath"
+	"reflect"
 
 	"github.com/dgraph-io/badger/v4"
 	gap "github.com/muesli/go-app-paths"
@@ -17,8 +19,11 @@ var (
 )
 
 type embeddedStore struct {
-	storageId string
-	database  *badgerhold.Store
+	storageId   string
+	readOnly    bool
+	inMemory    bool
+	snapshotDir string
+	database    *badgerhold.Store
 }
 
 type EmbeddedStore interface {
@@ -30,6 +35,9 @@ type EmbeddedStore interface {
 	Delete(key string, v any) error
 	Find(query *badgerhold.Query, result interface{}) error
 	FindOne(query *badgerhold.Query, result interface{}) error
+	ForEach(query *badgerhold.Query, fn interface{}) error
+	ForEachKey(from, to string, record interface{}, fn func() error) error
+	DeleteMatching(dataType interface{}, query *badgerhold.Query) error
 	Get(key string, v interface{}) error
 	MustGet(key string, v interface{}) bool
 }
@@ -44,6 +52,27 @@ func NewEmbeddedStore(storageId string) EmbeddedStore {
 	}
 }
 
+// NewReadOnlyEmbeddedStore creates an EmbeddedStore that never modifies the database.
+//
+// Badger can't open a database read-only while another process is writing to it,
+// so Open copies the database into a temporary snapshot and works on that copy.
+// This allows reading the data while the service is running. Close removes the snapshot.
+func NewReadOnlyEmbeddedStore(storageId string) EmbeddedStore {
+	return &embeddedStore{
+		storageId: storageId,
+		readOnly:  true,
+	}
+}
+
+// NewInMemoryEmbeddedStore creates an EmbeddedStore that keeps all data in memory.
+// The data is lost on Close, this is used by the script test harness.
+func NewInMemoryEmbeddedStore() EmbeddedStore {
+	return &embeddedStore{
+		storageId: "memory",
+		inMemory:  true,
+	}
+}
+
 func (p *embeddedStore) Find(query *badgerhold.Query, result interface{}) error {
 	if p.database == nil {
 		return ErrDatabaseNotCreated
@@ -67,6 +96,91 @@ func (p *embeddedStore) FindOne(query *badgerhold.Query, result interface{}) err
 
 	return nil
 }
+
+func (p *embeddedStore) ForEach(query *badgerhold.Query, fn interface{}) error {
+	if p.database == nil {
+		return ErrDatabaseNotCreated
+	}
+
+	if err := p.database.ForEach(query, fn); err != nil {
+		return errors.Wrap(err, "ForEach")
+	}
+
+	return nil
+}
+
+// ForEachKey decodes each record of the type of record with a key in [from, to) into record and calls fn, in key order.
+//
+// Unlike ForEach, it seeks to from instead of scanning all records of the type. The keys must
+// have the same length, so that the order of the encoded keys is the order of the keys.
+// Iteration stops at the first error returned by fn.
+func (p *embeddedStore) ForEachKey(from, to string, record interface{}, fn func() error) error {
+	if p.database == nil {
+		return ErrDatabaseNotCreated
+	}
+
+	value := reflect.ValueOf(record)
+	if value.Kind() != reflect.Ptr {
+		return errors.New("ForEachKey: record must be a pointer")
+	}
+
+	// badgerhold prefixes the encoded keys with the name of the type
+	prefix := []byte("bh_" + value.Elem().Type().Name() + ":")
+
+	start, err := badgerhold.DefaultEncode(from)
+	if err != nil {
+		return errors.Wrap(err, "ForEachKey")
+	}
+	end, err := badgerhold.DefaultEncode(to)
+	if err != nil {
+		return errors.Wrap(err, "ForEachKey")
+	}
+	start, end = append(prefix, start...), append(prefix, end...)
+
+	err = p.database.Badger().View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			item := it.Item()
+			if bytes.Compare(item.Key(), end) >= 0 {
+				return nil
+			}
+
+			// gob merges into maps, so every record is decoded into a zero value
+			value.Elem().Set(reflect.Zero(value.Elem().Type()))
+			if err := item.Value(func(data []byte) error {
+				return badgerhold.DefaultDecode(data, record)
+			}); err != nil {
+				return err
+			}
+
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return errors.Wrap(err, "ForEachKey")
+}
+
+func (p *embeddedStore) DeleteMatching(dataType interface{}, query *badgerhold.Query) error {
+	if p.database == nil {
+		return ErrDatabaseNotCreated
+	}
+
+	if err := p.database.DeleteMatching(dataType, query); err != nil {
+		return errors.Wrap(err, "DeleteMatching")
+	}
+
+	return nil
+}
+
 func (p *embeddedStore) Insert(key string, v any) error {
 	if p.database == nil {
 		return ErrDatabaseNotCreated
@@ -145,11 +259,35 @@ func (p *embeddedStore) Open() (err error) {
 		return
 	}
 
+	if p.inMemory {
+		options := badgerhold.DefaultOptions
+		options.Options = badger.DefaultOptions("").
+			WithInMemory(true).
+			WithLogger(nil)
+
+		p.database, err = badgerhold.Open(options)
+		return errors.Wrap(err, "Open")
+	}
+
 	dd, err := p.dataPath(p.dbName())
 	if err != nil {
 		return errors.Wrap(err, "dataPath")
 	}
 
+	if p.readOnly {
+		p.snapshotDir, err = os.MkdirTemp("", p.dbName())
+		if err != nil {
+			return errors.Wrap(err, "MkdirTemp")
+		}
+
+		if err := copyDatabase(dd, p.snapshotDir); err != nil {
+			os.RemoveAll(p.snapshotDir)
+			return errors.Wrap(err, "copyDatabase")
+		}
+
+		dd = p.snapshotDir
+	}
+
 	options := badgerhold.DefaultOptions
 	options.Options = badger.DefaultOptions(dd).
 		WithValueLogFileSize(10000000).
@@ -169,6 +307,13 @@ func (p *embeddedStore) Close() (err error) {
 		p.database = nil
 	}
 
+	if p.snapshotDir != "" {
+		if e := os.RemoveAll(p.snapshotDir); e != nil && err == nil {
+			err = e
+		}
+		p.snapshotDir = ""
+	}
+
 	return
 }
 
@@ -183,9 +328,81 @@ func (p *embeddedStore) dataPath(id string) (string, error) {
 		return "", errors.Wrap(err, "DataPath")
 	}
 
+	if p.readOnly {
+		if _, err := os.Stat(dataPath); err != nil {
+			return "", errors.Wrap(err, "Stat")
+		}
+
+		return dataPath, nil
+	}
+
 	if err := os.MkdirAll(dataPath, 0755); err != nil {
 		return "", errors.Wrap(err, "MkdirAll")
 	}
 
 	return dataPath, nil
 }
+
+// copyDatabase copies all database files except the directory lock from src to dst.
+func copyDatabase(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return errors.Wrap(err, "ReadDir")
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == "LOCK" {
+			continue
+		}
+
+		if err := copySparseFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return errors.Wrapf(err, "copy %s", entry.Name())
+		}
+	}
+
+	return nil
+}
+
+// copySparseFile copies src to dst, skipping blocks of zeros.
+// Badger preallocates its memtable files, so a plain copy would write mostly zeros.
+func copySparseFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buf := make([]byte, 64*1024)
+	zero := make([]byte, len(buf))
+
+	var size int64
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if bytes.Equal(buf[:n], zero[:n]) {
+				_, err = out.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = out.Write(buf[:n])
+			}
+			if err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return out.Truncate(size)
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/timshannon/badgerhold/v4"
+)
+
+// HistoryRecord holds the sensor values of one poll cycle.
+type HistoryRecord struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// historyKey returns a zero padded key, so that records are iterated in chronological order.
+func historyKey(t time.Time) string {
+	return fmt.Sprintf("history/%020d", t.UnixNano())
+}
+
+// AppendHistory writes the values of a Snapshot as a HistoryRecord to the embedded store.
+// Only readings of QualityGood or QualityStale are written, missing and warming up
+// metrics have no average yet and stay missing in the record.
+//
+// Parameters:
+// - es: the embedded store to write to.
+// - snapshot: the snapshot to persist.
+//
+// Returns:
+// - error: an error if the record could not be written.
+func AppendHistory(es EmbeddedStore, snapshot Snapshot) error {
+	rec := HistoryRecord{
+		Time:   snapshot.Time(),
+		Values: make(map[string]float64),
+	}
+
+	for _, reading := range snapshot.Readings() {
+		if reading.Quality == QualityGood || reading.Quality == QualityStale {
+			rec.Values[reading.Metric.ID.String()] = reading.Value
+		}
+	}
+
+	if err := es.Upsert(historyKey(rec.Time), rec); err != nil {
+		return errors.Wrap(err, "upsert history record")
+	}
+
+	return nil
+}
+
+// ForEachHistory calls fn for each HistoryRecord in [from, to) in chronological order.
+//
+// The records are read by their time ordered keys, so only the requested range is read.
+// Iteration stops at the first error returned by fn.
+func ForEachHistory(es EmbeddedStore, from, to time.Time, fn func(rec *HistoryRecord) error) error {
+	// keys of times before 1970 are negative and don't sort, the zero time overflows
+	if epoch := time.Unix(0, 0); from.Before(epoch) {
+		from = epoch
+	}
+	if !to.After(from) {
+		return nil
+	}
+
+	var rec HistoryRecord
+	err := es.ForEachKey(historyKey(from), historyKey(to), &rec, func() error {
+		current := rec
+		return fn(&current)
+	})
+	if err != nil {
+		return errors.Wrap(err, "iterate history")
+	}
+
+	return nil
+}
+
+// PruneHistory deletes all HistoryRecords older than before.
+func PruneHistory(es EmbeddedStore, before time.Time) error {
+	query := badgerhold.Where("Time").Lt(before)
+	if err := es.DeleteMatching(&HistoryRecord{}, query); err != nil {
+		return errors.Wrap(err, "prune history")
+	}
+
+	return nil
+}
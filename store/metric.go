@@ -0,0 +1,127 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DataID identifies a metric by its name, e.g. "humidity".
+// The name is used as key in payloads and history records.
+type DataID string
+
+// String returns the metric name.
+func (id DataID) String() string {
+	return string(id)
+}
+
+const (
+	Humidity             DataID = "humidity"
+	Temperature          DataID = "temperature"
+	Conductivity         DataID = "conductivity"
+	Salinity             DataID = "salinity"
+	TDS                  DataID = "tds"
+	ConductivityWeighted DataID = "conductivity_weighted"
+	ConductivityRaw      DataID = "conductivity_raw"
+)
+
+const (
+	// DeviceSoilSensor is the device name of the CWT-Soil-THC-S soil sensor.
+	DeviceSoilSensor = "soil"
+)
+
+var (
+	ErrMetricInvalid    = errors.New("metric name cannot be empty")
+	ErrMetricRegistered = errors.New("metric already registered")
+)
+
+// Metric describes a value which is held in the SensorStore.
+type Metric struct {
+	ID          DataID
+	Unit        string
+	Description string
+	Device      string
+	// DeviceClass is the kind of quantity, e.g. "temperature", as used by home assistant.
+	// It is empty if no such class exists.
+	DeviceClass string
+}
+
+type MetricRegistry interface {
+	Register(metric Metric) error
+	Lookup(name string) (Metric, bool)
+	Metrics() []Metric
+}
+
+type metricRegistry struct {
+	mutex   sync.RWMutex
+	metrics []Metric
+	index   map[DataID]int
+}
+
+// Register adds a metric to the registry.
+//
+// It returns ErrMetricRegistered if a metric with the same name already exists.
+func (p *metricRegistry) Register(metric Metric) error {
+	if metric.ID == "" {
+		return ErrMetricInvalid
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.index[metric.ID]; ok {
+		return errors.Wrapf(ErrMetricRegistered, "register %s", metric.ID)
+	}
+
+	p.index[metric.ID] = len(p.metrics)
+	p.metrics = append(p.metrics, metric)
+	return nil
+}
+
+// Lookup returns the metric with the given name.
+func (p *metricRegistry) Lookup(name string) (Metric, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if idx, ok := p.index[DataID(name)]; ok {
+		return p.metrics[idx], true
+	}
+
+	return Metric{}, false
+}
+
+// Metrics returns all registered metrics in registration order.
+func (p *metricRegistry) Metrics() []Metric {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	metrics := make([]Metric, len(p.metrics))
+	copy(metrics, p.metrics)
+	return metrics
+}
+
+// NewMetricRegistry creates a new empty MetricRegistry.
+func NewMetricRegistry() MetricRegistry {
+	return &metricRegistry{
+		index: make(map[DataID]int),
+	}
+}
+
+// registerBuiltinMetrics registers the metrics provided by the soil sensor.
+func registerBuiltinMetrics(registry MetricRegistry) {
+	builtins := []Metric{
+		{ID: Humidity, Unit: "%", Description: "soil humidity", Device: DeviceSoilSensor, DeviceClass: "moisture"},
+		{ID: Temperature, Unit: "°C", Description: "soil temperature", Device: DeviceSoilSensor, DeviceClass: "temperature"},
+		{ID: Conductivity, Unit: "mS/cm", Description: "humidity compensated soil conductivity", Device: DeviceSoilSensor, DeviceClass: "conductivity"},
+		{ID: Salinity, Unit: "mg/L", Description: "soil salinity", Device: DeviceSoilSensor},
+		{ID: TDS, Unit: "mg/L", Description: "total dissolved solids", Device: DeviceSoilSensor},
+		{ID: ConductivityWeighted, Unit: "mS/cm", Description: "soil conductivity normalized to 25°C", Device: DeviceSoilSensor, DeviceClass: "conductivity"},
+		{ID: ConductivityRaw, Unit: "µS/cm", Description: "raw soil conductivity", Device: DeviceSoilSensor, DeviceClass: "conductivity"},
+	}
+
+	for _, metric := range builtins {
+		if err := registry.Register(metric); err != nil {
+			panic(err)
+		}
+	}
+}
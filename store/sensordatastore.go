@@ -2,13 +2,15 @@ package store
 
 import (
 	"sync"
-)
+	"time"
 
-//go:generate stringer -type=DataID
+	"github.com/denkhaus/sensor/clock"
+)
 
 type ValueStore struct {
 	data     []float64
 	capacity int
+	updated  time.Time
 }
 
 // GetAverage calculates the average value stored in the ValueStore.
@@ -45,6 +47,26 @@ func (p *ValueStore) Set(value float64) {
 	}
 
 	p.data = append(p.data, value)
+	p.updated = clock.Now()
+}
+
+// Last returns the most recent value stored in the ValueStore, or 0 if there are none.
+func (p *ValueStore) Last() float64 {
+	if len(p.data) == 0 {
+		return 0.0
+	}
+
+	return p.data[len(p.data)-1]
+}
+
+// IsFilled reports whether enough values are stored to calculate the average.
+func (p *ValueStore) IsFilled() bool {
+	return len(p.data) >= p.capacity
+}
+
+// Updated returns the time of the last call to Set.
+func (p *ValueStore) Updated() time.Time {
+	return p.updated
 }
 
 // NewValueStore creates a new instance of ValueStore with the given capacity.
@@ -61,44 +83,102 @@ func NewValueStore(size int) *ValueStore {
 	}
 }
 
-type DataID int
-
-const (
-	Humidity DataID = iota
-	Temperature
-	Conductivity
-	Salinity
-	TDS
-	ConductivityWeighted
-	ConductivityRaw
-)
-
 type SensorStore interface {
 	Set(id DataID, data float64)
 	Get(id DataID) float64
+	Update(fn func(batch Batch))
+	Snapshot() Snapshot
+	SetStaleAfter(dur time.Duration)
+	Subscribe(bufferSize int, filters ...Filter) Subscription
 }
 
 type sensorStore struct {
-	mutex    sync.RWMutex
-	data     map[DataID]*ValueStore
-	capacity int
+	mutex      sync.RWMutex
+	data       map[DataID]*ValueStore
+	capacity   int
+	registry   MetricRegistry
+	staleAfter time.Duration
+	subscribers
 }
 
 // Set sets the value of a sensor data in the sensor store.
 //
 // It takes a DataID and a float64 value as parameters.
 // It does not return anything.
+// Subscribers are notified of the update.
 func (p *sensorStore) Set(id DataID, data float64) {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	if store, ok := p.data[id]; ok {
-		store.Set(data)
-		return
+	ev := p.set(id, data)
+	p.mutex.Unlock()
+
+	p.publish(ev)
+}
+
+// Update runs fn with a Batch writing to the store under one lock,
+// so a Snapshot sees either none or all values set by fn.
+// fn must only use the Batch, calling the store itself would deadlock.
+// Subscribers are notified after all values are set.
+func (p *sensorStore) Update(fn func(batch Batch)) {
+	batch := &sensorBatch{store: p}
+
+	p.mutex.Lock()
+	fn(batch)
+	p.mutex.Unlock()
+
+	for _, ev := range batch.events {
+		p.publish(ev)
 	}
+}
 
-	store := NewValueStore(p.capacity)
-	p.data[id] = store
+// set adds data to the values of id and returns the Event for the subscribers, p.mutex must be held.
+func (p *sensorStore) set(id DataID, data float64) Event {
+	store, ok := p.data[id]
+	if !ok {
+		store = NewValueStore(p.capacity)
+		p.data[id] = store
+	}
+
+	previous := store.GetAverage()
 	store.Set(data)
+
+	return Event{
+		Metric:   id,
+		Value:    store.GetAverage(),
+		Previous: previous,
+		Raw:      data,
+		Quality:  p.quality(store, store.Updated()),
+		Time:     store.Updated(),
+	}
+}
+
+// get returns the average of id, p.mutex must be held.
+func (p *sensorStore) get(id DataID) float64 {
+	if store, ok := p.data[id]; ok {
+		return store.GetAverage()
+	}
+
+	return 0.0
+}
+
+// Batch sets and reads values within SensorStore.Update.
+type Batch interface {
+	Set(id DataID, data float64)
+	Get(id DataID) float64
+}
+
+type sensorBatch struct {
+	store  *sensorStore
+	events []Event
+}
+
+// Set sets the value of a sensor data, it is visible to Get of the batch right away.
+func (p *sensorBatch) Set(id DataID, data float64) {
+	p.events = append(p.events, p.store.set(id, data))
+}
+
+// Get retrieves the value of a sensor data including the values set by the batch.
+func (p *sensorBatch) Get(id DataID) float64 {
+	return p.store.get(id)
 }
 
 // Get retrieves the value of a sensor data from the sensor store.
@@ -107,22 +187,78 @@ func (p *sensorStore) Set(id DataID, data float64) {
 func (p *sensorStore) Get(id DataID) float64 {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	if store, ok := p.data[id]; ok {
-		return store.GetAverage()
+
+	return p.get(id)
+}
+
+// Snapshot returns a consistent view of all registered metrics.
+//
+// All values are read under a single lock, so they can't be mixed up with
+// a concurrent update of the sensor reader.
+func (p *sensorStore) Snapshot() Snapshot {
+	metrics := p.registry.Metrics()
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	now := clock.Now()
+	snapshot := Snapshot{
+		time:     now,
+		readings: make([]Reading, 0, len(metrics)),
+		index:    make(map[DataID]int, len(metrics)),
 	}
 
-	return 0.0
+	for _, metric := range metrics {
+		reading := Reading{
+			Metric:  metric,
+			Quality: QualityMissing,
+		}
+
+		if store, ok := p.data[metric.ID]; ok {
+			reading.Value = store.GetAverage()
+			reading.Raw = store.Last()
+			reading.Updated = store.Updated()
+			reading.Quality = p.quality(store, now)
+		}
+
+		snapshot.index[metric.ID] = len(snapshot.readings)
+		snapshot.readings = append(snapshot.readings, reading)
+	}
+
+	return snapshot
+}
+
+// quality returns the Quality of the values in store at the given time.
+func (p *sensorStore) quality(store *ValueStore, now time.Time) Quality {
+	switch {
+	case p.staleAfter > 0 && now.Sub(store.Updated()) > p.staleAfter:
+		return QualityStale
+	case !store.IsFilled():
+		return QualityWarmingUp
+	}
+
+	return QualityGood
+}
+
+// SetStaleAfter sets the duration after which a metric without updates is marked as QualityStale.
+// A duration of 0 disables the staleness check.
+func (p *sensorStore) SetStaleAfter(dur time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.staleAfter = dur
 }
 
 // NewSensorStore creates a new instance of SensorStore with the given size.
 //
 // Parameters:
 // - size: The capacity of the SensorStore.
+// - registry: The MetricRegistry defining the metrics of a Snapshot.
 // Returns:
 // - SensorStore: A pointer to the newly created SensorStore.
-func NewSensorStore(size int) SensorStore {
+func NewSensorStore(size int, registry MetricRegistry) SensorStore {
 	return &sensorStore{
 		data:     make(map[DataID]*ValueStore),
 		capacity: size,
+		registry: registry,
 	}
 }
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"time"
+)
+
+// Quality describes how trustworthy the value of a Reading is.
+type Quality int
+
+const (
+	// QualityMissing means no value was received yet.
+	QualityMissing Quality = iota
+	// QualityWarmingUp means values were received, but not enough to calculate the average.
+	QualityWarmingUp
+	// QualityStale means no value was received for a while.
+	QualityStale
+	// QualityGood means the value is up to date.
+	QualityGood
+)
+
+// String returns the lower case name of the quality.
+func (q Quality) String() string {
+	switch q {
+	case QualityMissing:
+		return "missing"
+	case QualityWarmingUp:
+		return "warming_up"
+	case QualityStale:
+		return "stale"
+	case QualityGood:
+		return "good"
+	}
+
+	return "unknown"
+}
+
+// Reading is the state of a single metric within a Snapshot.
+type Reading struct {
+	Metric  Metric
+	Value   float64
+	Raw     float64
+	Quality Quality
+	Updated time.Time
+}
+
+// Snapshot is an immutable view of all metrics taken at a single point in time.
+type Snapshot struct {
+	time     time.Time
+	readings []Reading
+	index    map[DataID]int
+}
+
+// Time returns the time the snapshot was taken.
+func (s Snapshot) Time() time.Time {
+	return s.time
+}
+
+// Get returns the averaged value of the given metric, or 0 if the metric is unknown.
+func (s Snapshot) Get(id DataID) float64 {
+	if idx, ok := s.index[id]; ok {
+		return s.readings[idx].Value
+	}
+
+	return 0.0
+}
+
+// Reading returns the reading of the given metric.
+func (s Snapshot) Reading(id DataID) (Reading, bool) {
+	if idx, ok := s.index[id]; ok {
+		return s.readings[idx], true
+	}
+
+	return Reading{}, false
+}
+
+// Readings returns the readings of all metrics in registration order.
+func (s Snapshot) Readings() []Reading {
+	readings := make([]Reading, len(s.readings))
+	copy(readings, s.readings)
+	return readings
+}
+
+// Values returns the averaged values of all metrics keyed by metric name.
+func (s Snapshot) Values() map[string]float64 {
+	values := make(map[string]float64, len(s.readings))
+	for _, reading := range s.readings {
+		values[reading.Metric.ID.String()] = reading.Value
+	}
+
+	return values
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/denkhaus/sensor/config"
 	"github.com/pkg/errors"
@@ -10,12 +11,15 @@ import (
 )
 
 var (
-	sensorStoreInstance   SensorStore
-	embeddedStoreInstance EmbeddedStore
+	sensorStoreInstance    SensorStore
+	embeddedStoreInstance  EmbeddedStore
+	metricRegistryInstance MetricRegistry
 )
 
 func init() {
-	sensorStoreInstance = NewSensorStore(100)
+	metricRegistryInstance = NewMetricRegistry()
+	registerBuiltinMetrics(metricRegistryInstance)
+	sensorStoreInstance = NewSensorStore(100, metricRegistryInstance)
 }
 
 func Sensor() SensorStore {
@@ -26,6 +30,25 @@ func Embedded() EmbeddedStore {
 	return embeddedStoreInstance
 }
 
+func Registry() MetricRegistry {
+	return metricRegistryInstance
+}
+
+// RegisterMetric adds a metric to the global MetricRegistry.
+func RegisterMetric(metric Metric) error {
+	return metricRegistryInstance.Register(metric)
+}
+
+// LookupMetric returns the metric with the given name from the global MetricRegistry.
+func LookupMetric(name string) (Metric, bool) {
+	return metricRegistryInstance.Lookup(name)
+}
+
+// Metrics returns all metrics of the global MetricRegistry in registration order.
+func Metrics() []Metric {
+	return metricRegistryInstance.Metrics()
+}
+
 func Set(id DataID, data float64) {
 	sensorStoreInstance.Set(id, data)
 }
@@ -34,6 +57,16 @@ func Get(id DataID) float64 {
 	return sensorStoreInstance.Get(id)
 }
 
+// Update runs fn with a Batch of the global SensorStore, see SensorStore.Update.
+func Update(fn func(batch Batch)) {
+	sensorStoreInstance.Update(fn)
+}
+
+// Subscribe subscribes to updates of the global SensorStore.
+func Subscribe(bufferSize int, filters ...Filter) Subscription {
+	return sensorStoreInstance.Subscribe(bufferSize, filters...)
+}
+
 func Initialize(
 	ctx context.Context,
 	logger *logrus.Logger,
@@ -41,11 +74,37 @@ func Initialize(
 	eg *errgroup.Group,
 ) (EmbeddedStore, error) {
 
+	// a metric is stale if it missed more than two poll cycles
+	sensorStoreInstance.SetStaleAfter(time.Second * time.Duration(3*config.UpdateInterval))
+
 	storage := NewEmbeddedStore(config.Storage.Id)
 	if err := storage.Open(); err != nil {
 		return nil, errors.Wrap(err, "open storage")
 	}
 
 	embeddedStoreInstance = storage
+
+	if config.Storage.HistoryRetention > 0 {
+		retention := time.Hour * 24 * time.Duration(config.Storage.HistoryRetention)
+
+		eg.Go(func() error {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+
+			for {
+				if err := PruneHistory(storage, time.Now().Add(-retention)); err != nil {
+					logger.Warnf("history-pruner: %v", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					logger.Info("history-pruner: done received -> closing")
+					return nil
+				case <-ticker.C:
+				}
+			}
+		})
+	}
+
 	return storage, nil
 }
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is delivered to subscribers whenever a metric is updated.
+type Event struct {
+	Metric DataID
+	// Value is the averaged value after the update.
+	Value float64
+	// Previous is the averaged value before the update.
+	Previous float64
+	// Raw is the value passed to Set.
+	Raw     float64
+	Quality Quality
+	Time    time.Time
+}
+
+// Filter decides whether an Event is delivered to a subscriber.
+type Filter func(ev Event) bool
+
+// MetricFilter passes events of the given metrics only.
+func MetricFilter(ids ...DataID) Filter {
+	set := make(map[DataID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+
+	return func(ev Event) bool {
+		return set[ev.Metric]
+	}
+}
+
+// ThresholdFilter passes events whose averaged value crosses threshold in either direction.
+func ThresholdFilter(threshold float64) Filter {
+	return func(ev Event) bool {
+		return (ev.Previous < threshold) != (ev.Value < threshold)
+	}
+}
+
+// DeltaFilter passes events whose averaged value differs by at least delta
+// from the last value passed for the same metric. The first event of each metric is passed.
+func DeltaFilter(delta float64) Filter {
+	var mutex sync.Mutex
+	last := make(map[DataID]float64)
+
+	return func(ev Event) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if value, ok := last[ev.Metric]; ok && math.Abs(ev.Value-value) < delta {
+			return false
+		}
+
+		last[ev.Metric] = ev.Value
+		return true
+	}
+}
+
+type Subscription interface {
+	// C returns the channel the events are delivered to.
+	// It is closed when the subscription is closed.
+	C() <-chan Event
+	// Dropped returns the number of events dropped because the channel was full.
+	Dropped() uint64
+	Close()
+}
+
+type subscription struct {
+	ch      chan Event
+	filters []Filter
+	dropped atomic.Uint64
+	owner   *subscribers
+
+	// mutex guards ch against a send after Close
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (p *subscription) C() <-chan Event {
+	return p.ch
+}
+
+func (p *subscription) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Close removes the subscription and closes its channel.
+func (p *subscription) Close() {
+	p.owner.remove(p)
+}
+
+// matches reports whether ev passes all filters of the subscription.
+func (p *subscription) matches(ev Event) bool {
+	for _, filter := range p.filters {
+		if !filter(ev) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// send delivers ev without blocking, it is dropped if the channel is full.
+func (p *subscription) send(ev Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	select {
+	case p.ch <- ev:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// close closes the channel, later sends are ignored.
+func (p *subscription) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	close(p.ch)
+}
+
+// subscribers manages the subscriptions of a SensorStore.
+type subscribers struct {
+	mutex sync.Mutex
+	list  []*subscription
+}
+
+// Subscribe returns a Subscription receiving all events passing all filters.
+//
+// Events are never blocking the publisher: if the channel with bufferSize
+// is full, the event is dropped and counted.
+func (p *subscribers) Subscribe(bufferSize int, filters ...Filter) Subscription {
+	sub := &subscription{
+		ch:      make(chan Event, bufferSize),
+		filters: filters,
+		owner:   p,
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.list = append(p.list, sub)
+
+	return sub
+}
+
+func (p *subscribers) remove(sub *subscription) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for idx, s := range p.list {
+		if s == sub {
+			p.list = append(p.list[:idx], p.list[idx+1:]...)
+			sub.close()
+			return
+		}
+	}
+}
+
+// publish delivers ev to all matching subscriptions.
+//
+// It must be called without holding the lock of the SensorStore:
+// filters run outside of any lock and may read the store.
+func (p *subscribers) publish(ev Event) {
+	p.mutex.Lock()
+	list := make([]*subscription, len(p.list))
+	copy(list, p.list)
+	p.mutex.Unlock()
+
+	for _, sub := range list {
+		if sub.matches(ev) {
+			sub.send(ev)
+		}
+	}
+}
@@ -5,55 +5,110 @@ package symbols
 import (
 	"github.com/denkhaus/sensor/store"
 	"github.com/timshannon/badgerhold/v4"
+	"go/constant"
+	"go/token"
 	"reflect"
+	"time"
 )
 
 func init() {
 	Symbols["github.com/denkhaus/sensor/store/store"] = map[string]reflect.Value{
 		// function, constant and variable definitions
-		"Conductivity":            reflect.ValueOf(store.Conductivity),
-		"ConductivityRaw":         reflect.ValueOf(store.ConductivityRaw),
-		"ConductivityWeighted":    reflect.ValueOf(store.ConductivityWeighted),
-		"Embedded":                reflect.ValueOf(store.Embedded),
-		"ErrDatabaseNotCreated":   reflect.ValueOf(&store.ErrDatabaseNotCreated).Elem(),
-		"Get":                     reflect.ValueOf(store.Get),
-		"Humidity":                reflect.ValueOf(store.Humidity),
-		"Initialize":              reflect.ValueOf(store.Initialize),
-		"IsDocumentNotFoundError": reflect.ValueOf(store.IsDocumentNotFoundError),
-		"NewEmbeddedStore":        reflect.ValueOf(store.NewEmbeddedStore),
-		"NewSensorStore":          reflect.ValueOf(store.NewSensorStore),
-		"NewValueStore":           reflect.ValueOf(store.NewValueStore),
-		"Salinity":                reflect.ValueOf(store.Salinity),
-		"Sensor":                  reflect.ValueOf(store.Sensor),
-		"Set":                     reflect.ValueOf(store.Set),
-		"TDS":                     reflect.ValueOf(store.TDS),
-		"Temperature":             reflect.ValueOf(store.Temperature),
+		"AppendHistory":            reflect.ValueOf(store.AppendHistory),
+		"Conductivity":             reflect.ValueOf(store.Conductivity),
+		"ConductivityRaw":          reflect.ValueOf(store.ConductivityRaw),
+		"ConductivityWeighted":     reflect.ValueOf(store.ConductivityWeighted),
+		"DeltaFilter":              reflect.ValueOf(store.DeltaFilter),
+		"DeviceSoilSensor":         reflect.ValueOf(constant.MakeFromLiteral("\"soil\"", token.STRING, 0)),
+		"Embedded":                 reflect.ValueOf(store.Embedded),
+		"ErrDatabaseNotCreated":    reflect.ValueOf(&store.ErrDatabaseNotCreated).Elem(),
+		"ErrMetricInvalid":         reflect.ValueOf(&store.ErrMetricInvalid).Elem(),
+		"ErrMetricRegistered":      reflect.ValueOf(&store.ErrMetricRegistered).Elem(),
+		"ForEachHistory":           reflect.ValueOf(store.ForEachHistory),
+		"Get":                      reflect.ValueOf(store.Get),
+		"Humidity":                 reflect.ValueOf(store.Humidity),
+		"Initialize":               reflect.ValueOf(store.Initialize),
+		"IsDocumentNotFoundError":  reflect.ValueOf(store.IsDocumentNotFoundError),
+		"LookupMetric":             reflect.ValueOf(store.LookupMetric),
+		"MetricFilter":             reflect.ValueOf(store.MetricFilter),
+		"Metrics":                  reflect.ValueOf(store.Metrics),
+		"NewEmbeddedStore":         reflect.ValueOf(store.NewEmbeddedStore),
+		"NewInMemoryEmbeddedStore": reflect.ValueOf(store.NewInMemoryEmbeddedStore),
+		"NewMetricRegistry":        reflect.ValueOf(store.NewMetricRegistry),
+		"NewReadOnlyEmbeddedStore": reflect.ValueOf(store.NewReadOnlyEmbeddedStore),
+		"NewSensorStore":           reflect.ValueOf(store.NewSensorStore),
+		"NewValueStore":            reflect.ValueOf(store.NewValueStore),
+		"PruneHistory":             reflect.ValueOf(store.PruneHistory),
+		"QualityGood":              reflect.ValueOf(store.QualityGood),
+		"QualityMissing":           reflect.ValueOf(store.QualityMissing),
+		"QualityStale":             reflect.ValueOf(store.QualityStale),
+		"QualityWarmingUp":         reflect.ValueOf(store.QualityWarmingUp),
+		"RegisterMetric":           reflect.ValueOf(store.RegisterMetric),
+		"Registry":                 reflect.ValueOf(store.Registry),
+		"Salinity":                 reflect.ValueOf(store.Salinity),
+		"Sensor":                   reflect.ValueOf(store.Sensor),
+		"Set":                      reflect.ValueOf(store.Set),
+		"Subscribe":                reflect.ValueOf(store.Subscribe),
+		"TDS":                      reflect.ValueOf(store.TDS),
+		"Temperature":              reflect.ValueOf(store.Temperature),
+		"ThresholdFilter":          reflect.ValueOf(store.ThresholdFilter),
+		"Update":                   reflect.ValueOf(store.Update),
 
 		// type definitions
-		"DataID":        reflect.ValueOf((*store.DataID)(nil)),
-		"EmbeddedStore": reflect.ValueOf((*store.EmbeddedStore)(nil)),
-		"SensorStore":   reflect.ValueOf((*store.SensorStore)(nil)),
-		"ValueStore":    reflect.ValueOf((*store.ValueStore)(nil)),
+		"Batch":          reflect.ValueOf((*store.Batch)(nil)),
+		"DataID":         reflect.ValueOf((*store.DataID)(nil)),
+		"EmbeddedStore":  reflect.ValueOf((*store.EmbeddedStore)(nil)),
+		"Event":          reflect.ValueOf((*store.Event)(nil)),
+		"Filter":         reflect.ValueOf((*store.Filter)(nil)),
+		"HistoryRecord":  reflect.ValueOf((*store.HistoryRecord)(nil)),
+		"Metric":         reflect.ValueOf((*store.Metric)(nil)),
+		"MetricRegistry": reflect.ValueOf((*store.MetricRegistry)(nil)),
+		"Quality":        reflect.ValueOf((*store.Quality)(nil)),
+		"Reading":        reflect.ValueOf((*store.Reading)(nil)),
+		"SensorStore":    reflect.ValueOf((*store.SensorStore)(nil)),
+		"Snapshot":       reflect.ValueOf((*store.Snapshot)(nil)),
+		"Subscription":   reflect.ValueOf((*store.Subscription)(nil)),
+		"ValueStore":     reflect.ValueOf((*store.ValueStore)(nil)),
 
 		// interface wrapper definitions
-		"_EmbeddedStore": reflect.ValueOf((*_github_com_denkhaus_sensor_store_EmbeddedStore)(nil)),
-		"_SensorStore":   reflect.ValueOf((*_github_com_denkhaus_sensor_store_SensorStore)(nil)),
+		"_Batch":          reflect.ValueOf((*_github_com_denkhaus_sensor_store_Batch)(nil)),
+		"_EmbeddedStore":  reflect.ValueOf((*_github_com_denkhaus_sensor_store_EmbeddedStore)(nil)),
+		"_MetricRegistry": reflect.ValueOf((*_github_com_denkhaus_sensor_store_MetricRegistry)(nil)),
+		"_SensorStore":    reflect.ValueOf((*_github_com_denkhaus_sensor_store_SensorStore)(nil)),
+		"_Subscription":   reflect.ValueOf((*_github_com_denkhaus_sensor_store_Subscription)(nil)),
 	}
 }
 
+// _github_com_denkhaus_sensor_store_Batch is an interface wrapper for Batch type
+type _github_com_denkhaus_sensor_store_Batch struct {
+	IValue interface{}
+	WGet   func(id store.DataID) float64
+	WSet   func(id store.DataID, data float64)
+}
+
+func (W _github_com_denkhaus_sensor_store_Batch) Get(id store.DataID) float64 {
+	return W.WGet(id)
+}
+func (W _github_com_denkhaus_sensor_store_Batch) Set(id store.DataID, data float64) {
+	W.WSet(id, data)
+}
+
 // _github_com_denkhaus_sensor_store_EmbeddedStore is an interface wrapper for EmbeddedStore type
 type _github_com_denkhaus_sensor_store_EmbeddedStore struct {
-	IValue   interface{}
-	WClose   func() (err error)
-	WDelete  func(key string, v any) error
-	WFind    func(query *badgerhold.Query, result interface{}) error
-	WFindOne func(query *badgerhold.Query, result interface{}) error
-	WGet     func(key string, v interface{}) error
-	WInsert  func(key string, v any) error
-	WMustGet func(key string, v interface{}) bool
-	WOpen    func() (err error)
-	WUpdate  func(key string, v any) error
-	WUpsert  func(key string, v any) error
+	IValue          interface{}
+	WClose          func() (err error)
+	WDelete         func(key string, v any) error
+	WDeleteMatching func(dataType interface{}, query *badgerhold.Query) error
+	WFind           func(query *badgerhold.Query, result interface{}) error
+	WFindOne        func(query *badgerhold.Query, result interface{}) error
+	WForEach        func(query *badgerhold.Query, fn interface{}) error
+	WForEachKey     func(from string, to string, record interface{}, fn func() error) error
+	WGet            func(key string, v interface{}) error
+	WInsert         func(key string, v any) error
+	WMustGet        func(key string, v interface{}) bool
+	WOpen           func() (err error)
+	WUpdate         func(key string, v any) error
+	WUpsert         func(key string, v any) error
 }
 
 func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Close() (err error) {
@@ -62,12 +117,21 @@ func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Close() (err error) {
 func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Delete(key string, v any) error {
 	return W.WDelete(key, v)
 }
+func (W _github_com_denkhaus_sensor_store_EmbeddedStore) DeleteMatching(dataType interface{}, query *badgerhold.Query) error {
+	return W.WDeleteMatching(dataType, query)
+}
 func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Find(query *badgerhold.Query, result interface{}) error {
 	return W.WFind(query, result)
 }
 func (W _github_com_denkhaus_sensor_store_EmbeddedStore) FindOne(query *badgerhold.Query, result interface{}) error {
 	return W.WFindOne(query, result)
 }
+func (W _github_com_denkhaus_sensor_store_EmbeddedStore) ForEach(query *badgerhold.Query, fn interface{}) error {
+	return W.WForEach(query, fn)
+}
+func (W _github_com_denkhaus_sensor_store_EmbeddedStore) ForEachKey(from string, to string, record interface{}, fn func() error) error {
+	return W.WForEachKey(from, to, record, fn)
+}
 func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Get(key string, v interface{}) error {
 	return W.WGet(key, v)
 }
@@ -87,11 +151,33 @@ func (W _github_com_denkhaus_sensor_store_EmbeddedStore) Upsert(key string, v an
 	return W.WUpsert(key, v)
 }
 
+// _github_com_denkhaus_sensor_store_MetricRegistry is an interface wrapper for MetricRegistry type
+type _github_com_denkhaus_sensor_store_MetricRegistry struct {
+	IValue    interface{}
+	WLookup   func(name string) (store.Metric, bool)
+	WMetrics  func() []store.Metric
+	WRegister func(metric store.Metric) error
+}
+
+func (W _github_com_denkhaus_sensor_store_MetricRegistry) Lookup(name string) (store.Metric, bool) {
+	return W.WLookup(name)
+}
+func (W _github_com_denkhaus_sensor_store_MetricRegistry) Metrics() []store.Metric {
+	return W.WMetrics()
+}
+func (W _github_com_denkhaus_sensor_store_MetricRegistry) Register(metric store.Metric) error {
+	return W.WRegister(metric)
+}
+
 // _github_com_denkhaus_sensor_store_SensorStore is an interface wrapper for SensorStore type
 type _github_com_denkhaus_sensor_store_SensorStore struct {
-	IValue interface{}
-	WGet   func(id store.DataID) float64
-	WSet   func(id store.DataID, data float64)
+	IValue         interface{}
+	WGet           func(id store.DataID) float64
+	WSet           func(id store.DataID, data float64)
+	WSetStaleAfter func(dur time.Duration)
+	WSnapshot      func() store.Snapshot
+	WSubscribe     func(bufferSize int, filters ...store.Filter) store.Subscription
+	WUpdate        func(fn func(batch store.Batch))
 }
 
 func (W _github_com_denkhaus_sensor_store_SensorStore) Get(id store.DataID) float64 {
@@ -100,3 +186,33 @@ func (W _github_com_denkhaus_sensor_store_SensorStore) Get(id store.DataID) floa
 func (W _github_com_denkhaus_sensor_store_SensorStore) Set(id store.DataID, data float64) {
 	W.WSet(id, data)
 }
+func (W _github_com_denkhaus_sensor_store_SensorStore) SetStaleAfter(dur time.Duration) {
+	W.WSetStaleAfter(dur)
+}
+func (W _github_com_denkhaus_sensor_store_SensorStore) Snapshot() store.Snapshot {
+	return W.WSnapshot()
+}
+func (W _github_com_denkhaus_sensor_store_SensorStore) Subscribe(bufferSize int, filters ...store.Filter) store.Subscription {
+	return W.WSubscribe(bufferSize, filters...)
+}
+func (W _github_com_denkhaus_sensor_store_SensorStore) Update(fn func(batch store.Batch)) {
+	W.WUpdate(fn)
+}
+
+// _github_com_denkhaus_sensor_store_Subscription is an interface wrapper for Subscription type
+type _github_com_denkhaus_sensor_store_Subscription struct {
+	IValue   interface{}
+	WC       func() <-chan store.Event
+	WClose   func()
+	WDropped func() uint64
+}
+
+func (W _github_com_denkhaus_sensor_store_Subscription) C() <-chan store.Event {
+	return W.WC()
+}
+func (W _github_com_denkhaus_sensor_store_Subscription) Close() {
+	W.WClose()
+}
+func (W _github_com_denkhaus_sensor_store_Subscription) Dropped() uint64 {
+	return W.WDropped()
+}
@@ -5,22 +5,62 @@ package symbols
 import (
 	"github.com/denkhaus/sensor/types"
 	"reflect"
+	"time"
 )
 
 func init() {
 	Symbols["github.com/denkhaus/sensor/types/types"] = map[string]reflect.Value{
 		// function, constant and variable definitions
+		"ActuatorKindPulse":           reflect.ValueOf(types.ActuatorKindPulse),
+		"ActuatorKindSwitch":          reflect.ValueOf(types.ActuatorKindSwitch),
+		"ActuatorModeAuto":            reflect.ValueOf(types.ActuatorModeAuto),
+		"ActuatorModeManual":          reflect.ValueOf(types.ActuatorModeManual),
+		"Actuators":                   reflect.ValueOf(types.Actuators),
+		"NewActuatorRegistry":         reflect.ValueOf(types.NewActuatorRegistry),
 		"NewTimespan":                 reflect.ValueOf(types.NewTimespan),
+		"OnTimer":                     reflect.ValueOf(types.OnTimer),
 		"SwitchTimerStateInitialized": reflect.ValueOf(types.SwitchTimerStateInitialized),
 		"SwitchTimerStateOff":         reflect.ValueOf(types.SwitchTimerStateOff),
 		"SwitchTimerStateOn":          reflect.ValueOf(types.SwitchTimerStateOn),
 
 		// type definitions
+		"Actuator":         reflect.ValueOf((*types.Actuator)(nil)),
+		"ActuatorKind":     reflect.ValueOf((*types.ActuatorKind)(nil)),
+		"ActuatorMode":     reflect.ValueOf((*types.ActuatorMode)(nil)),
+		"ActuatorRegistry": reflect.ValueOf((*types.ActuatorRegistry)(nil)),
 		"DurationCallback": reflect.ValueOf((*types.DurationCallback)(nil)),
+		"MqttClient":       reflect.ValueOf((*types.MqttClient)(nil)),
+		"MqttHandler":      reflect.ValueOf((*types.MqttHandler)(nil)),
 		"PulseTimer":       reflect.ValueOf((*types.PulseTimer)(nil)),
 		"ScriptContext":    reflect.ValueOf((*types.ScriptContext)(nil)),
 		"Span":             reflect.ValueOf((*types.Span)(nil)),
 		"SwitchTimer":      reflect.ValueOf((*types.SwitchTimer)(nil)),
 		"SwitchTimerState": reflect.ValueOf((*types.SwitchTimerState)(nil)),
+		"TimerListener":    reflect.ValueOf((*types.TimerListener)(nil)),
+
+		// interface wrapper definitions
+		"_MqttClient": reflect.ValueOf((*_github_com_denkhaus_sensor_types_MqttClient)(nil)),
 	}
 }
+
+// _github_com_denkhaus_sensor_types_MqttClient is an interface wrapper for MqttClient type
+type _github_com_denkhaus_sensor_types_MqttClient struct {
+	IValue       interface{}
+	WPublish     func(topic string, qos byte, retained bool, payload []byte) error
+	WRetained    func(topic string, timeout time.Duration) ([]byte, bool, error)
+	WSubscribe   func(topic string, handler types.MqttHandler) error
+	WUnsubscribe func(topic string) error
+}
+
+func (W _github_com_denkhaus_sensor_types_MqttClient) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	return W.WPublish(topic, qos, retained, payload)
+}
+func (W _github_com_denkhaus_sensor_types_MqttClient) Retained(topic string, timeout time.Duration) ([]byte, bool, error) {
+	return W.WRetained(topic, timeout)
+}
+func (W _github_com_denkhaus_sensor_types_MqttClient) Subscribe(topic string, handler types.MqttHandler) error {
+	return W.WSubscribe(topic, handler)
+}
+func (W _github_com_denkhaus_sensor_types_MqttClient) Unsubscribe(topic string) error {
+	return W.WUnsubscribe(topic)
+}
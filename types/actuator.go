@@ -0,0 +1,401 @@
+package types
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/sensor/clock"
+	"github.com/denkhaus/sensor/io"
+	"github.com/pkg/errors"
+	"periph.io/x/conn/v3/gpio"
+)
+
+type ActuatorKind int
+
+const (
+	ActuatorKindSwitch ActuatorKind = iota
+	ActuatorKindPulse
+)
+
+type ActuatorMode int
+
+const (
+	// ActuatorModeAuto means the actuator is driven by its timer.
+	ActuatorModeAuto ActuatorMode = iota
+	// ActuatorModeManual means the timer is suspended and the actuator is driven by commands.
+	ActuatorModeManual
+)
+
+// String returns "auto" or "manual".
+func (m ActuatorMode) String() string {
+	if m == ActuatorModeManual {
+		return "manual"
+	}
+
+	return "auto"
+}
+
+// Actuator is a gpio pin driven by a SwitchTimer or PulseTimer.
+//
+// All pin operations are serialized, so a timer and a remote command
+// can't drive the pin at the same time.
+type Actuator struct {
+	Name string
+
+	mutex    sync.Mutex
+	kind     ActuatorKind
+	inverted bool
+	pin      *io.Pin
+	mode     ActuatorMode
+	on       bool
+	resync   bool
+	// owner is the name of the script driving the actuator
+	owner string
+	// pulse is the running pulse, it is aborted by On, Off and SafeState
+	pulse *actuatorPulse
+
+	onSince time.Time
+	onTime  time.Duration
+	pulses  uint64
+}
+
+// actuatorPulse aborts a running pulse.
+type actuatorPulse struct {
+	cancel context.CancelFunc
+}
+
+// abortPulse aborts the running pulse, the caller takes over the pin.
+// The caller must hold the mutex.
+func (p *Actuator) abortPulse() {
+	if p.pulse != nil {
+		p.pulse.cancel()
+		p.pulse = nil
+	}
+}
+
+// setActive sets the pin to its active or inactive level with respect to the polarity.
+// The caller must hold the mutex.
+func (p *Actuator) setActive(active bool) error {
+	var err error
+	if active != p.inverted {
+		err = p.pin.SetHigh()
+	} else {
+		err = p.pin.SetLow()
+	}
+
+	p.setOn(active)
+	return err
+}
+
+// setOn updates the state and accumulates the on-time. The caller must hold the mutex.
+func (p *Actuator) setOn(on bool) {
+	now := clock.Now()
+	if on && !p.on {
+		p.onSince = now
+	}
+	if !on && p.on {
+		p.onTime += now.Sub(p.onSince)
+	}
+
+	p.on = on
+}
+
+// On activates the actuator.
+func (p *Actuator) On() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.abortPulse()
+	return p.setActive(true)
+}
+
+// Off deactivates the actuator, a running pulse is aborted.
+func (p *Actuator) Off() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.abortPulse()
+	return p.setActive(false)
+}
+
+// Pulse activates the actuator for dur and blocks until it is deactivated again.
+func (p *Actuator) Pulse(dur time.Duration) error {
+	return p.PulseContext(context.Background(), dur)
+}
+
+// PulseContext activates the actuator for dur and blocks until it is deactivated again.
+// The pulse ends early when ctx is done or the actuator is switched by On, Off or SafeState.
+//
+// The actuator isn't locked while the pulse runs, only one pulse runs at a time.
+func (p *Actuator) PulseContext(ctx context.Context, dur time.Duration) error {
+	p.mutex.Lock()
+	if p.pulse != nil {
+		p.mutex.Unlock()
+		return errors.Errorf("actuator %s is already pulsing", p.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pulse := &actuatorPulse{cancel: cancel}
+	p.pulse = pulse
+	p.pulses++
+
+	if err := p.setActive(true); err != nil {
+		p.pulse = nil
+		p.mutex.Unlock()
+		return err
+	}
+	p.mutex.Unlock()
+
+	var aborted error
+	select {
+	case <-clock.After(dur):
+	case <-ctx.Done():
+		aborted = errors.Wrapf(ctx.Err(), "pulse of actuator %s aborted", p.Name)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// On, Off or SafeState took over the pin
+	if p.pulse != pulse {
+		return aborted
+	}
+
+	p.pulse = nil
+	if err := p.setActive(false); err != nil {
+		return err
+	}
+
+	return aborted
+}
+
+// Kind returns whether the actuator is driven by a SwitchTimer or a PulseTimer.
+func (p *Actuator) Kind() ActuatorKind {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.kind
+}
+
+// IsOn reports whether the actuator is active.
+func (p *Actuator) IsOn() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.on
+}
+
+// OnTime returns the total time the actuator was active.
+func (p *Actuator) OnTime() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.on {
+		return p.onTime + clock.Since(p.onSince)
+	}
+
+	return p.onTime
+}
+
+// Pulses returns the number of pulses of the actuator.
+func (p *Actuator) Pulses() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.pulses
+}
+
+// Owner returns the name of the script driving the actuator.
+func (p *Actuator) Owner() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.owner
+}
+
+// claim records the script driving the actuator.
+func (p *Actuator) claim(owner string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.owner = owner
+}
+
+// Mode returns whether the actuator is driven by its timer or by commands.
+func (p *Actuator) Mode() ActuatorMode {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.mode
+}
+
+// SetMode sets whether the actuator is driven by its timer or by commands.
+//
+// When switching back to ActuatorModeAuto, the timer reapplies its state to the pin.
+func (p *Actuator) SetMode(mode ActuatorMode) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.mode == ActuatorModeManual && mode == ActuatorModeAuto {
+		p.resync = true
+	}
+
+	p.mode = mode
+}
+
+// takeResync reports whether the timer has to reapply its state and resets the flag.
+func (p *Actuator) takeResync() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	resync := p.resync
+	p.resync = false
+	return resync
+}
+
+// Execute executes a manual command on the actuator.
+//
+// Supported commands are ON, OFF, PULSE <duration> and AUTO. ON and OFF suspend
+// the timer of the actuator until AUTO is received. Pulses are limited to maxPulse,
+// so ON is refused for pulse actuators, it would keep them on without limit.
+func (p *Actuator) Execute(command string, maxPulse time.Duration) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return errors.New("empty command")
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "ON":
+		if p.Kind() == ActuatorKindPulse {
+			return errors.Errorf("actuator %s is a pulse actuator, use PULSE <duration>", p.Name)
+		}
+
+		p.SetMode(ActuatorModeManual)
+		return p.On()
+	case "OFF":
+		p.SetMode(ActuatorModeManual)
+		return p.Off()
+	case "AUTO":
+		p.SetMode(ActuatorModeAuto)
+		return nil
+	case "PULSE":
+		if len(fields) != 2 {
+			return errors.New("usage: PULSE <duration>")
+		}
+
+		dur, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return errors.Wrap(err, "parse pulse duration")
+		}
+
+		if dur <= 0 || dur > maxPulse {
+			return errors.Errorf("pulse duration %s exceeds the limit of %s", dur, maxPulse)
+		}
+
+		return p.Pulse(dur)
+	}
+
+	return errors.Errorf("unknown command %s", fields[0])
+}
+
+// ActuatorRegistry holds all actuators known to the service.
+type ActuatorRegistry struct {
+	mutex     sync.RWMutex
+	actuators map[string]*Actuator
+}
+
+// NewActuatorRegistry creates a new empty ActuatorRegistry.
+func NewActuatorRegistry() *ActuatorRegistry {
+	return &ActuatorRegistry{
+		actuators: make(map[string]*Actuator),
+	}
+}
+
+// Register returns the actuator with the given name, creating it on first use.
+// The pin and polarity of an existing actuator are updated.
+func (p *ActuatorRegistry) Register(name string, kind ActuatorKind, inverted bool, pin gpio.PinIO) *Actuator {
+	p.mutex.Lock()
+	act, ok := p.actuators[name]
+	if !ok {
+		act = &Actuator{Name: name}
+		p.actuators[name] = act
+	}
+	p.mutex.Unlock()
+
+	act.mutex.Lock()
+	defer act.mutex.Unlock()
+
+	act.kind = kind
+	act.inverted = inverted
+	act.pin = io.NewPin(pin)
+	return act
+}
+
+// Get returns the actuator with the given name.
+func (p *ActuatorRegistry) Get(name string) (*Actuator, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	act, ok := p.actuators[name]
+	return act, ok
+}
+
+// List returns all actuators ordered by name.
+func (p *ActuatorRegistry) List() []*Actuator {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	list := make([]*Actuator, 0, len(p.actuators))
+	for _, act := range p.actuators {
+		list = append(list, act)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// SafeState switches all actuators of the script owner off and suspends their timers.
+// An empty owner selects all actuators.
+//
+// All actuators are switched, even if one of them fails. The first error is returned.
+func (p *ActuatorRegistry) SafeState(owner string) error {
+	var first error
+	for _, act := range p.List() {
+		if owner != "" && act.Owner() != owner {
+			continue
+		}
+
+		act.SetMode(ActuatorModeManual)
+		if err := act.Off(); err != nil && first == nil {
+			first = errors.Wrapf(err, "switch off actuator %s", act.Name)
+		}
+	}
+
+	return first
+}
+
+// Resume hands all actuators of the script owner back to their timers.
+// An empty owner selects all actuators.
+func (p *ActuatorRegistry) Resume(owner string) {
+	for _, act := range p.List() {
+		if owner != "" && act.Owner() != owner {
+			continue
+		}
+
+		act.SetMode(ActuatorModeAuto)
+	}
+}
+
+// Clear removes all actuators, so a simulated script run starts without state of a previous one.
+func (p *ActuatorRegistry) Clear() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.actuators = make(map[string]*Actuator)
+}
+
+var actuatorRegistryInstance = NewActuatorRegistry()
+
+// Actuators returns the global ActuatorRegistry.
+func Actuators() *ActuatorRegistry {
+	return actuatorRegistryInstance
+}
@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+// MqttHandler handles a message received on a topic subscribed by a script.
+type MqttHandler func(ctx *ScriptContext, topic string, payload []byte) error
+
+// MqttClient is the mqtt connection of the service shared by the scripts.
+//
+// Handlers are called by the script runner between the runs of the script like the
+// event entrypoints, so they never run concurrently with the script. The subscriptions
+// of a script end when it is reloaded, so Setup should subscribe.
+type MqttClient interface {
+	// Publish publishes payload to topic.
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	// Subscribe calls handler for each message on the topic filter, which may contain the wildcards + and #.
+	// The handler receives the retained messages of the filter first. A second subscription of the same filter replaces the handler.
+	Subscribe(topic string, handler MqttHandler) error
+	// Unsubscribe removes the handler of the topic filter.
+	Unsubscribe(topic string) error
+	// Retained returns the retained message of topic, waiting up to timeout for the broker to send it.
+	// It reports false if there is no retained message.
+	Retained(topic string, timeout time.Duration) ([]byte, bool, error)
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/gob"
 	"time"
 
-	"github.com/denkhaus/sensor/io"
+	"github.com/denkhaus/sensor/clock"
 	"periph.io/x/conn/v3/gpio"
 )
 
@@ -20,7 +20,6 @@ type PulseTimer struct {
 	WaitDuration      time.Duration
 	PulseOnInitialize bool
 	Inverted          bool
-	pin               *io.Pin
 }
 
 // Write writes the PulseTimer to the embedded store in the given ScriptContext.
@@ -34,33 +33,28 @@ func (p *PulseTimer) Write(ctx *ScriptContext) error {
 
 // pulse performs a pulse operation based on the condition and updates the timer.
 //
-// It takes a ScriptContext and a function returning a boolean as parameters.
+// It takes a ScriptContext, a function returning a boolean and the Actuator to pulse as parameters.
 // It returns an error.
-func (p *PulseTimer) pulse(ctx *ScriptContext, fnCondition func() bool) error {
+func (p *PulseTimer) pulse(ctx *ScriptContext, fnCondition func() bool, act *Actuator) error {
 
 	if fnCondition() {
 		ctx.Logger.Infof("pulsetimer %s: pulse for %s", p.Name, p.PulseDuration)
 
-		// pulse high
-		if p.Inverted {
-			p.pin.PulseLow(p.PulseDuration)
-		} else {
-			p.pin.PulseHigh(p.PulseDuration)
+		if err := act.PulseContext(ctx.context(), p.PulseDuration); err != nil {
+			ctx.Logger.Warnf("pulsetimer %s: %v", p.Name, err)
 		}
 
 	} else {
 		ctx.Logger.Infof("pulsetimer %s: condition not met. try again in %s", p.Name, p.WaitDuration)
 
-		// set low
-		if p.Inverted {
-			p.pin.SetHigh()
-		} else {
-			p.pin.SetLow()
+		if err := act.Off(); err != nil {
+			ctx.Logger.Warnf("pulsetimer %s: %v", p.Name, err)
 		}
 	}
 
 	//reset wait timer
-	p.CurrentSpan = NewTimespan(time.Now(), p.WaitDuration)
+	p.CurrentSpan = NewTimespan(clock.Now(), p.WaitDuration)
+	notifyTimer(ctx.Name, p.Name)
 	return p.Write(ctx)
 }
 
@@ -68,32 +62,42 @@ func (p *PulseTimer) pulse(ctx *ScriptContext, fnCondition func() bool) error {
 //
 // It takes a ScriptContext, a function fnCondition that returns a boolean,
 // and a gpio.PinIO as parameters.
+// The pin is registered as Actuator, while the actuator is in manual mode the timer is suspended.
 // It returns an error.
 func (p *PulseTimer) Process(ctx *ScriptContext, fnCondition func() bool, pin gpio.PinIO) error {
 	ctx.Logger.Debugf("process pulsetimer %s", p.Name)
 
-	if p.pin == nil {
-		p.pin = io.NewPin(pin)
+	act := Actuators().Register(p.Name, ActuatorKindPulse, p.Inverted, pin)
+	act.claim(ctx.Name)
+	if act.Mode() == ActuatorModeManual {
+		ctx.Logger.Debugf("pulsetimer %s is in manual mode", p.Name)
+		return nil
+	}
+
+	if act.takeResync() {
+		if err := act.Off(); err != nil {
+			ctx.Logger.Warnf("pulsetimer %s: %v", p.Name, err)
+		}
 	}
 
 	if p.CurrentSpan.IsZero() {
 		ctx.Logger.Infof("initialize pulsetimer %s", p.Name)
 		if p.PulseOnInitialize {
-			if err := p.pulse(ctx, fnCondition); err != nil {
+			if err := p.pulse(ctx, fnCondition, act); err != nil {
 				return err
 			}
 		} else {
-			p.CurrentSpan = NewTimespan(time.Now(), p.WaitDuration)
+			p.CurrentSpan = NewTimespan(clock.Now(), p.WaitDuration)
 		}
 
 		return p.Write(ctx)
 	}
 
-	if p.CurrentSpan.ContainsTime(time.Now()) {
+	if p.CurrentSpan.ContainsTime(clock.Now()) {
 		return nil
 	}
 
-	if err := p.pulse(ctx, fnCondition); err != nil {
+	if err := p.pulse(ctx, fnCondition, act); err != nil {
 		return err
 	}
 
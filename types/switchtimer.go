@@ -4,7 +4,7 @@ import (
 	"encoding/gob"
 	"time"
 
-	"github.com/denkhaus/sensor/io"
+	"github.com/denkhaus/sensor/clock"
 	"periph.io/x/conn/v3/gpio"
 )
 
@@ -22,6 +22,18 @@ const (
 	SwitchTimerStateOn
 )
 
+// String returns "initialized", "off" or "on".
+func (s SwitchTimerState) String() string {
+	switch s {
+	case SwitchTimerStateOff:
+		return "off"
+	case SwitchTimerStateOn:
+		return "on"
+	}
+
+	return "initialized"
+}
+
 type SwitchTimer struct {
 	Name         string
 	Description  string
@@ -30,7 +42,6 @@ type SwitchTimer struct {
 	OnDuration   time.Duration
 	OffDuration  time.Duration
 	Inverted     bool
-	pin          *io.Pin
 }
 
 // Write writes the SwitchTimer to the embedded store in the given ScriptContext.
@@ -44,15 +55,37 @@ func (p *SwitchTimer) Write(ctx *ScriptContext) error {
 	return ctx.EmbeddedStore.Upsert(p.Name, p)
 }
 
+// switchActuator activates or deactivates the actuator and logs pin errors.
+func (p *SwitchTimer) switchActuator(ctx *ScriptContext, act *Actuator, on bool) {
+	var err error
+	if on {
+		err = act.On()
+	} else {
+		err = act.Off()
+	}
+
+	if err != nil {
+		ctx.Logger.Warnf("switchtimer %s: %v", p.Name, err)
+	}
+}
+
 // Process processes the SwitchTimer.
 //
 // It takes a ScriptContext and a gpio.PinIO as parameters.
+// The pin is registered as Actuator, while the actuator is in manual mode the timer is suspended.
 // It returns an error.
 func (p *SwitchTimer) Process(ctx *ScriptContext, dcb DurationCallback, pin gpio.PinIO) error {
 	ctx.Logger.Debugf("process switchtimer %s", p.Name)
 
-	if p.pin == nil {
-		p.pin = io.NewPin(pin)
+	act := Actuators().Register(p.Name, ActuatorKindSwitch, p.Inverted, pin)
+	act.claim(ctx.Name)
+	if act.Mode() == ActuatorModeManual {
+		ctx.Logger.Debugf("switchtimer %s is in manual mode", p.Name)
+		return nil
+	}
+
+	if act.takeResync() && p.CurrentState != SwitchTimerStateInitialized {
+		p.switchActuator(ctx, act, p.CurrentState == SwitchTimerStateOn)
 	}
 
 	var onDuration, offDuration time.Duration
@@ -66,50 +99,38 @@ func (p *SwitchTimer) Process(ctx *ScriptContext, dcb DurationCallback, pin gpio
 
 	if p.CurrentState == SwitchTimerStateInitialized {
 		p.CurrentState = SwitchTimerStateOff
-		p.CurrentSpan = NewTimespan(time.Now(), offDuration)
-
-		if p.Inverted {
-			p.pin.SetHigh()
-		} else {
-			p.pin.SetLow()
-		}
+		p.CurrentSpan = NewTimespan(clock.Now(), offDuration)
+		p.switchActuator(ctx, act, false)
 
 		ctx.Logger.Infof("switchtimer %s turned off", p.Name)
+		notifyTimer(ctx.Name, p.Name)
 		return p.Write(ctx)
 	}
 
 	if p.CurrentState == SwitchTimerStateOff {
-		if p.CurrentSpan.ContainsTime(time.Now()) {
+		if p.CurrentSpan.ContainsTime(clock.Now()) {
 			return nil
 		}
 
 		p.CurrentState = SwitchTimerStateOn
-		p.CurrentSpan = NewTimespan(time.Now(), onDuration)
-
-		if p.Inverted {
-			p.pin.SetLow()
-		} else {
-			p.pin.SetHigh()
-		}
+		p.CurrentSpan = NewTimespan(clock.Now(), onDuration)
+		p.switchActuator(ctx, act, true)
 
 		ctx.Logger.Infof("switchtimer %s turned on", p.Name)
+		notifyTimer(ctx.Name, p.Name)
 		return p.Write(ctx)
 	}
 
 	if p.CurrentState == SwitchTimerStateOn {
-		if p.CurrentSpan.ContainsTime(time.Now()) {
+		if p.CurrentSpan.ContainsTime(clock.Now()) {
 			return nil
 		}
 		p.CurrentState = SwitchTimerStateOff
-		p.CurrentSpan = NewTimespan(time.Now(), p.OffDuration)
-
-		if p.Inverted {
-			p.pin.SetHigh()
-		} else {
-			p.pin.SetLow()
-		}
+		p.CurrentSpan = NewTimespan(clock.Now(), p.OffDuration)
+		p.switchActuator(ctx, act, false)
 
 		ctx.Logger.Infof("switchtimer %s turned off", p.Name)
+		notifyTimer(ctx.Name, p.Name)
 		return p.Write(ctx)
 	}
 
@@ -0,0 +1,30 @@
+package types
+
+import "sync"
+
+// TimerListener is notified when a timer of a script switches its actuator.
+type TimerListener func(script string, timer string)
+
+var timerListeners struct {
+	mutex sync.RWMutex
+	list  []TimerListener
+}
+
+// OnTimer registers a listener notified when a SwitchTimer switches or a PulseTimer fires.
+//
+// Listeners are called by the script run processing the timer, so they must not block.
+func OnTimer(listener TimerListener) {
+	timerListeners.mutex.Lock()
+	defer timerListeners.mutex.Unlock()
+	timerListeners.list = append(timerListeners.list, listener)
+}
+
+// notifyTimer notifies all listeners that the timer of script switched.
+func notifyTimer(script string, timer string) {
+	timerListeners.mutex.RLock()
+	defer timerListeners.mutex.RUnlock()
+
+	for _, listener := range timerListeners.list {
+		listener(script, timer)
+	}
+}
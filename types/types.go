@@ -1,13 +1,34 @@
 package types
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/denkhaus/sensor/store"
 )
 
 type ScriptContext struct {
+	// Name is the name of the running script.
+	Name          string
 	Logger        *logrus.Logger
 	SensorStore   store.SensorStore
 	EmbeddedStore store.EmbeddedStore
+	// Snapshot is taken right before each script run, so all values belong together.
+	Snapshot store.Snapshot
+	// Context is done when the run exceeds its timeout or the service stops.
+	// Long running scripts should check it and return early.
+	Context context.Context
+	// Mqtt publishes and subscribes on the mqtt connection of the service.
+	// It returns errors if mqtt is disabled.
+	Mqtt MqttClient
+}
+
+// context returns the Context of the run, which may be unset outside of the script runner.
+func (p *ScriptContext) context() context.Context {
+	if p.Context == nil {
+		return context.Background()
+	}
+
+	return p.Context
 }